@@ -1,95 +1,102 @@
 package core
 
-import (
-	"runtime"
-	"strings"
-)
+import "errors"
 
 const ENDTOKEN = "[<EOT>]"
 
+// BOTTOKEN is put before every text, so its successors are the tokens that
+// usually open a sentence.
+const BOTTOKEN = "[<BOT>]"
+
+// Tokenizer combines a Vocabulary with the TransitionCounts of the texts
+// added to it. Their fields and methods are promoted, so a Tokenizer can be
+// used wherever either part is needed.
 type Tokenizer struct {
-	Tokens      map[string]int
-	UnigramMap  map[int]int
-	Count       int
-	UnigramFreq map[int]map[int]int // Persisted for reward mechanism
+	*Vocabulary
+	*TransitionCounts
 }
 
 func NewTokenizer() *Tokenizer {
 	return &Tokenizer{
-		Tokens:      make(map[string]int),
-		UnigramMap:  make(map[int]int),
-		UnigramFreq: make(map[int]map[int]int),
-		Count:       0,
+		Vocabulary:       NewVocabulary(),
+		TransitionCounts: NewTransitionCounts(),
 	}
 }
 
-// AddToken populates the UnigramFreq map to track frequencies.
-func (t *Tokenizer) AddToken(token string, nexttoken string) {
-	// Ensure the first token exists in the dictionary.
-	tokIdx, exists := t.GetTokenIndex(token)
-	if !exists {
-		t.Tokens[token] = t.Count
-		tokIdx = t.Count
-		t.Count++
-	}
+// ErrUnsupportedTokenizer is returned when a model is saved or learns new
+// texts but its Lexicon and TransitionStats are not the *Vocabulary and
+// *TransitionCounts of a Tokenizer, which are what model files store.
+var ErrUnsupportedTokenizer = errors.New("model lexicon and stats are not a Tokenizer")
 
-	// Ensure the next token exists in the dictionary.
-	nextIdx, exists := t.GetTokenIndex(nexttoken)
-	if !exists {
-		t.Tokens[nexttoken] = t.Count
-		nextIdx = t.Count
-		t.Count++
+// tokenizerOf returns the Tokenizer made of lexicon and stats, which share
+// their data with it, or ErrUnsupportedTokenizer.
+func tokenizerOf(lexicon Lexicon, stats TransitionStats) (*Tokenizer, error) {
+	if t, ok := lexicon.(*Tokenizer); ok {
+		lexicon = t.Vocabulary
 	}
-
-	// Update counts for the next token using the new structure.
-	if t.UnigramFreq[tokIdx] == nil {
-		t.UnigramFreq[tokIdx] = make(map[int]int)
+	if t, ok := stats.(*Tokenizer); ok {
+		stats = t.TransitionCounts
 	}
-	t.UnigramFreq[tokIdx][nextIdx]++
-}
-
-// BuildUnigramMap iterates through the counts and selects the most frequent next token for each token.
-func (t *Tokenizer) BuildUnigramMap() {
-	for tokID, freqMap := range t.UnigramFreq {
-		maxFreq := 0
-		bestNextID := -1
-		for nextID, freq := range freqMap {
-			if freq > maxFreq {
-				maxFreq = freq
-				bestNextID = nextID
-			}
-		}
-		if bestNextID != -1 {
-			t.UnigramMap[tokID] = bestNextID
-		}
+	vocabulary, ok := lexicon.(*Vocabulary)
+	if !ok || vocabulary == nil {
+		return nil, ErrUnsupportedTokenizer
 	}
-
-	// We no longer clear the frequency map to use it for rewards.
-	runtime.GC()
+	counts, ok := stats.(*TransitionCounts)
+	if !ok || counts == nil {
+		return nil, ErrUnsupportedTokenizer
+	}
+	return &Tokenizer{Vocabulary: vocabulary, TransitionCounts: counts}, nil
 }
 
-func (t *Tokenizer) GetTokenIndex(token string) (int, bool) {
-	idx, exists := t.Tokens[token]
-	return idx, exists
+// NewNGramTokenizer creates a tokenizer that also counts contexts of up to
+// order-1 tokens for an NGramModel.
+func NewNGramTokenizer(order int) *Tokenizer {
+	t := NewTokenizer()
+	t.NGramOrder = order
+	return t
 }
 
-func (t *Tokenizer) GetToken(idx int) string {
-	for k, v := range t.Tokens {
-		if v == idx {
-			return k
-		}
-	}
-	return ""
+// AddToken populates the UnigramFreq map to track frequencies.
+func (t *Tokenizer) AddToken(token string, nexttoken string) {
+	// Ensure both tokens exist in the dictionary.
+	tokIdx := t.addWord(token)
+	nextIdx := t.addWord(nexttoken)
+
+	t.Add(tokIdx, nextIdx)
 }
 
 func (t *Tokenizer) AddtoModel(text string) {
-	words := strings.Split(text, " ")
+	t.addText(text, false)
+}
+
+// addText counts the transitions of text and returns the indices of its
+// tokens, BOTTOKEN and ENDTOKEN included. New words are added to the
+// vocabulary, unless known is set and the vocabulary was pruned: then they
+// count as UNKTOKEN, so the vocabulary does not grow back.
+func (t *Tokenizer) addText(text string, known bool) []int {
+	words := t.Tokenize(text)
 	if len(words) < 1 {
-		return
+		return nil
+	}
+	words = append(append([]string{BOTTOKEN}, words...), ENDTOKEN)
+
+	unkIdx, pruned := t.Tokens[UNKTOKEN]
+	indices := make([]int, len(words))
+	for i, word := range words {
+		if idx, exists := t.Tokens[word]; exists {
+			indices[i] = idx
+		} else if known && pruned {
+			indices[i] = unkIdx
+		} else {
+			indices[i] = t.addWord(word)
+		}
+	}
+	for i := 0; i < len(indices)-1; i++ {
+		t.Add(indices[i], indices[i+1])
 	}
-	words = append(words, ENDTOKEN)
 
-	for i := 0; i < len(words)-1; i++ {
-		t.AddToken(words[i], words[i+1])
+	if t.NGramOrder > 2 {
+		t.addContexts(indices)
 	}
+	return indices
 }
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"strings"
+	"testing"
+)
+
+func TestGetToken(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("나는 학교에 간다")
+
+	for token, idx := range tokenizer.Tokens {
+		if got := tokenizer.GetToken(idx); got != token {
+			t.Errorf("GetToken(%d) = %q, want %q", idx, got, token)
+		}
+	}
+	if got := tokenizer.GetToken(tokenizer.Count); got != "" {
+		t.Errorf("GetToken out of range = %q, want empty", got)
+	}
+}
+
+func TestRebuildTokenList(t *testing.T) {
+	// Older files were written without TokenList.
+	type oldTokenizer struct {
+		Tokens      map[string]int
+		UnigramMap  map[int]int
+		Count       int
+		UnigramFreq map[int]map[int]int
+	}
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("나는 학교에 간다")
+
+	var buf bytes.Buffer
+	old := oldTokenizer{tokenizer.Tokens, tokenizer.UnigramMap, tokenizer.Count, tokenizer.UnigramFreq}
+	if err := gob.NewEncoder(&buf).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := decodeTokenizer(gob.NewDecoder(&buf), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < tokenizer.Count; i++ {
+		if decoded.GetToken(i) != tokenizer.GetToken(i) {
+			t.Errorf("GetToken(%d) = %q, want %q", i, decoded.GetToken(i), tokenizer.GetToken(i))
+		}
+	}
+}
+
+func TestPrune(t *testing.T) {
+	tokenizer := NewNGramTokenizer(3)
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("나는 빵을 먹었다")
+
+	removed := tokenizer.Prune(2, 0)
+	if removed != 1 {
+		t.Errorf("Prune removed %d tokens, want 1", removed)
+	}
+	if _, exists := tokenizer.GetTokenIndex("빵을"); exists {
+		t.Error("빵을 is still in the vocabulary")
+	}
+	if tokenizer.Count != len(tokenizer.TokenList) || tokenizer.Count != len(tokenizer.Tokens) {
+		t.Fatalf("Count %d, %d in TokenList, %d in Tokens", tokenizer.Count, len(tokenizer.TokenList), len(tokenizer.Tokens))
+	}
+	for token, idx := range tokenizer.Tokens {
+		if tokenizer.GetToken(idx) != token {
+			t.Errorf("index %d maps back to %q, want %q", idx, tokenizer.GetToken(idx), token)
+		}
+	}
+
+	// 빵을 was merged into UNKTOKEN, in the bigram and the trigram counts.
+	from, _ := tokenizer.GetTokenIndex("나는")
+	unk, _ := tokenizer.GetTokenIndex(UNKTOKEN)
+	ate, _ := tokenizer.GetTokenIndex("먹었다")
+	if got := tokenizer.UnigramFreq[from][unk]; got != 1 {
+		t.Errorf("count of 나는 -> UNK = %d, want 1", got)
+	}
+	if got := tokenizer.ContextFreq[contextKey([]int{from, unk})][ate]; got != 1 {
+		t.Errorf("count of 나는 UNK -> 먹었다 = %d, want 1", got)
+	}
+
+	// Unknown words are counted as UNKTOKEN from now on.
+	transitions := CountTransitions(tokenizer, []string{"나는 떡을 먹었다"})
+	if transitions[from][unk] != 1 || transitions[unk][ate] != 1 {
+		t.Errorf("CountTransitions = %v, want the unknown word counted as UNK", transitions)
+	}
+
+	// MaxVocab keeps the most frequent words plus the special tokens.
+	tokenizer.Prune(0, 4)
+	if tokenizer.Count != 4 {
+		t.Errorf("after Prune(0, 4) the vocabulary has %d tokens, want 4", tokenizer.Count)
+	}
+}
+
+func TestGenerateNeverEmitsUnknown(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("나는 빵을 먹었다")
+	tokenizer.AddtoModel("나는 떡을 먹었다")
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.Prune(2, 0)
+	tokenizer.BuildUnigramMap()
+
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 2)
+	for i := 0; i < 20; i++ {
+		model.Sampling = NewSamplingConfig(1.5, 0, 0, int64(i))
+		text, err := model.Generate(context.Background(), "나는", GenerateOptions{MaxTokens: 5})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(text, UNKTOKEN) {
+			t.Fatalf("generated %q", text)
+		}
+	}
+}
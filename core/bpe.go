@@ -0,0 +1,290 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// BPEMerge joins two adjacent symbols into one.
+type BPEMerge struct {
+	Left, Right string
+}
+
+// BPE is a byte-pair encoding subword pre-tokenizer. Each word is split
+// into characters, which are merged pairwise in the order of Merges. Pieces
+// after the first in a word start with SuffixMarker. Characters not seen in
+// training fall back to one token per byte, so no word is out of vocabulary.
+type BPE struct {
+	Merges   []BPEMerge
+	Alphabet []string // Characters seen in training
+	Pieces   []string // Tokens the training words were split into
+
+	once    sync.Once
+	ranks   map[BPEMerge]int
+	chars   map[string]bool
+	pieces  map[string]bool
+	sources map[string]BPEMerge
+}
+
+// TrainBPE learns up to numMerges merges from the words of texts, merging
+// the most frequent adjacent pair each time. Ties are broken alphabetically
+// so the result only depends on texts.
+func TrainBPE(texts []string, numMerges int) *BPE {
+	// 1. Count words and characters
+	wordFreq := make(map[string]int)
+	chars := make(map[string]bool)
+	for _, text := range texts {
+		for _, word := range strings.Fields(text) {
+			wordFreq[word]++
+			for _, r := range word {
+				chars[string(r)] = true
+			}
+		}
+	}
+
+	uniqueWords := make([]string, 0, len(wordFreq))
+	for word := range wordFreq {
+		uniqueWords = append(uniqueWords, word)
+	}
+	sort.Strings(uniqueWords)
+	words := make([][]string, len(uniqueWords))
+	for i, word := range uniqueWords {
+		for _, r := range word {
+			words[i] = append(words[i], string(r))
+		}
+	}
+
+	b := &BPE{}
+	for char := range chars {
+		b.Alphabet = append(b.Alphabet, char)
+	}
+	sort.Strings(b.Alphabet)
+
+	// 2. Merge the most frequent pair until none occurs twice
+	for len(b.Merges) < numMerges {
+		pairCounts := make(map[BPEMerge]int)
+		for i, symbols := range words {
+			for k := 0; k+1 < len(symbols); k++ {
+				pairCounts[BPEMerge{symbols[k], symbols[k+1]}] += wordFreq[uniqueWords[i]]
+			}
+		}
+
+		var best BPEMerge
+		bestCount := 1
+		for pair, count := range pairCounts {
+			if count > bestCount || count == bestCount && bestCount > 1 && pairLess(pair, best) {
+				best, bestCount = pair, count
+			}
+		}
+		if bestCount < 2 {
+			break
+		}
+
+		b.Merges = append(b.Merges, best)
+		rank := map[BPEMerge]int{best: 0}
+		for i := range words {
+			words[i] = applyMerges(words[i], rank)
+		}
+	}
+
+	// 3. Record the tokens of the training words
+	pieces := make(map[string]bool)
+	for _, symbols := range words {
+		for k, symbol := range symbols {
+			if k > 0 {
+				symbol = SuffixMarker + symbol
+			}
+			pieces[symbol] = true
+		}
+	}
+	for piece := range pieces {
+		b.Pieces = append(b.Pieces, piece)
+	}
+	sort.Strings(b.Pieces)
+	return b
+}
+
+// pairLess orders merges alphabetically.
+func pairLess(a, b BPEMerge) bool {
+	if a.Left != b.Left {
+		return a.Left < b.Left
+	}
+	return a.Right < b.Right
+}
+
+// applyMerges merges adjacent symbols by rank, lowest first, until no pair
+// has a rank.
+func applyMerges(symbols []string, ranks map[BPEMerge]int) []string {
+	for len(symbols) > 1 {
+		bestRank, bestK := -1, -1
+		for k := 0; k+1 < len(symbols); k++ {
+			if rank, ok := ranks[BPEMerge{symbols[k], symbols[k+1]}]; ok && (bestK < 0 || rank < bestRank) {
+				bestRank, bestK = rank, k
+			}
+		}
+		if bestK < 0 {
+			break
+		}
+		symbols[bestK] += symbols[bestK+1]
+		symbols = append(symbols[:bestK+1], symbols[bestK+2:]...)
+	}
+	return symbols
+}
+
+// prepare builds the lookup tables, which are not stored in model files.
+func (b *BPE) prepare() {
+	b.once.Do(func() {
+		b.ranks = make(map[BPEMerge]int, len(b.Merges))
+		for rank, merge := range b.Merges {
+			b.ranks[merge] = rank
+		}
+		b.chars = make(map[string]bool, len(b.Alphabet))
+		for _, char := range b.Alphabet {
+			b.chars[char] = true
+		}
+		b.pieces = make(map[string]bool, len(b.Pieces))
+		for _, piece := range b.Pieces {
+			b.pieces[piece] = true
+		}
+		b.sources = make(map[string]BPEMerge, len(b.Merges))
+		for _, merge := range b.Merges {
+			if _, ok := b.sources[merge.Left+merge.Right]; !ok {
+				b.sources[merge.Left+merge.Right] = merge
+			}
+		}
+	})
+}
+
+func (b *BPE) Split(text string) []string {
+	b.prepare()
+	var tokens []string
+	for _, word := range strings.Fields(text) {
+		var symbols []string
+		for _, r := range word {
+			if char := string(r); b.chars[char] {
+				symbols = append(symbols, char)
+				continue
+			}
+			// Byte fallback for characters not seen in training
+			buf := make([]byte, utf8.RuneLen(r))
+			utf8.EncodeRune(buf, r)
+			for _, c := range buf {
+				symbols = append(symbols, byteToken(c))
+			}
+		}
+		for k, symbol := range applyMerges(symbols, b.ranks) {
+			tokens = b.appendPiece(tokens, symbol, k == 0)
+		}
+	}
+	return tokens
+}
+
+// appendPiece appends the token of piece, which starts a word if first. A
+// piece training never produced in that position is replaced by the pieces
+// it was merged from, and a character by its bytes, so Split only returns
+// tokens listed by Symbols. BPEs without Pieces append every piece as is.
+func (b *BPE) appendPiece(tokens []string, piece string, first bool) []string {
+	token := piece
+	if !first {
+		token = SuffixMarker + piece
+	}
+	if len(b.Pieces) == 0 || b.pieces[token] {
+		return append(tokens, token)
+	}
+	if _, ok := parseByteToken(piece); ok {
+		return append(tokens, token)
+	}
+	if merge, ok := b.sources[piece]; ok {
+		tokens = b.appendPiece(tokens, merge.Left, first)
+		return b.appendPiece(tokens, merge.Right, false)
+	}
+	for k, c := range []byte(piece) {
+		if k > 0 || !first {
+			tokens = append(tokens, SuffixMarker+byteToken(c))
+		} else {
+			tokens = append(tokens, byteToken(c))
+		}
+	}
+	return tokens
+}
+
+func (b *BPE) Join(tokens []string) string {
+	return joinTokens(tokens, func(piece string) string {
+		if c, ok := parseByteToken(piece); ok {
+			return string([]byte{c})
+		}
+		return piece
+	})
+}
+
+// Symbols returns every token Split can produce: the Pieces of the training
+// words and the bytes that can start or continue a word.
+func (b *BPE) Symbols() []string {
+	if len(b.Pieces) == 0 {
+		return b.allSymbols()
+	}
+	symbols := append([]string(nil), b.Pieces...)
+	for c := 0; c < 256; c++ {
+		if startsWord(byte(c)) {
+			symbols = append(symbols, byteToken(byte(c)))
+		}
+		if continuesWord(byte(c)) {
+			symbols = append(symbols, SuffixMarker+byteToken(byte(c)))
+		}
+	}
+	return symbols
+}
+
+// startsWord reports whether c can be the first byte of a word: an ASCII
+// character other than a space, or the first byte of a longer UTF-8 character.
+func startsWord(c byte) bool {
+	if c < utf8.RuneSelf {
+		return !unicode.IsSpace(rune(c))
+	}
+	return c >= 0xc2 && c <= 0xf4
+}
+
+// continuesWord reports whether c can follow another byte of a word.
+func continuesWord(c byte) bool {
+	return startsWord(c) || c >= 0x80 && c <= 0xbf
+}
+
+// allSymbols returns the symbols of a BPE trained before Pieces were
+// recorded: each character, merge result and byte, with and without
+// SuffixMarker.
+func (b *BPE) allSymbols() []string {
+	pieces := append([]string(nil), b.Alphabet...)
+	for _, merge := range b.Merges {
+		pieces = append(pieces, merge.Left+merge.Right)
+	}
+	for c := 0; c < 256; c++ {
+		pieces = append(pieces, byteToken(byte(c)))
+	}
+
+	symbols := make([]string, 0, 2*len(pieces))
+	for _, piece := range pieces {
+		symbols = append(symbols, piece, SuffixMarker+piece)
+	}
+	return symbols
+}
+
+// byteToken is the fallback token of a single byte.
+func byteToken(c byte) string {
+	return fmt.Sprintf("<0x%02X>", c)
+}
+
+// parseByteToken returns the byte of a byteToken.
+func parseByteToken(token string) (byte, bool) {
+	var c byte
+	if len(token) != 6 {
+		return 0, false
+	}
+	if _, err := fmt.Sscanf(token, "<0x%02X>", &c); err != nil {
+		return 0, false
+	}
+	return c, true
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTrainBPE(t *testing.T) {
+	bpe := TrainBPE([]string{"학교에 갔다", "학교를 좋아한다", "학교 가자"}, 10)
+
+	if got := bpe.Split("학교에"); !reflect.DeepEqual(got, []string{"학교", "##에"}) {
+		t.Errorf("Split(학교에) = %q, want 학교 and ##에", got)
+	}
+
+	// Unseen characters fall back to bytes and still round trip.
+	for _, text := range []string{"학교에 갔다", "새 학교🎉", "café"} {
+		if got := bpe.Join(bpe.Split(text)); got != text {
+			t.Errorf("Join(Split(%q)) = %q", text, got)
+		}
+	}
+}
+
+func TestBPESymbols(t *testing.T) {
+	bpe := TrainBPE([]string{"학교에 갔다", "학교를 좋아한다", "학교 가자"}, 10)
+	symbols := make(map[string]bool)
+	for _, symbol := range bpe.Symbols() {
+		symbols[symbol] = true
+	}
+	if len(symbols) >= 2*(len(bpe.Alphabet)+len(bpe.Merges)+256) {
+		t.Errorf("%d symbols, want fewer than every piece in every position", len(symbols))
+	}
+	if symbols[SuffixMarker+"학교"] || symbols["<0x80>"] {
+		t.Error("symbols include pieces Split never produces")
+	}
+
+	// 자 and 학교 only start or end words in training.
+	for _, text := range []string{"자학교", "가학교에", "café ok"} {
+		tokens := bpe.Split(text)
+		for _, token := range tokens {
+			if !symbols[token] {
+				t.Errorf("Split(%q) = %q: %q is not a symbol", text, tokens, token)
+			}
+		}
+		if got := bpe.Join(tokens); got != text {
+			t.Errorf("Join(Split(%q)) = %q", text, got)
+		}
+	}
+}
+
+func TestBPETokenizerHasNoUnknownTokens(t *testing.T) {
+	texts := []string{"오늘 날씨가 좋다", "오늘 밥을 먹었다", "날씨가 맑다"}
+	tokenizer := NewTokenizer()
+	tokenizer.UseBPE(TrainBPE(texts, 20))
+	for _, text := range texts {
+		tokenizer.AddtoModel(text)
+	}
+	tokenizer.BuildUnigramMap()
+
+	var buf bytes.Buffer
+	if _, err := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	model, err := ReadModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := model.Lexicon.Tokenize("내일 날씨는 흐림☔")
+	for _, token := range tokens {
+		if _, ok := model.Lexicon.GetTokenIndex(token); !ok {
+			t.Errorf("token %q of %q is not in the vocabulary", token, tokens)
+		}
+	}
+	if got := model.Lexicon.Detokenize(tokens); got != "내일 날씨는 흐림☔" {
+		t.Errorf("Detokenize = %q", got)
+	}
+
+	keywords := NewExtractor(model).Extract("날씨가 좋다", 0)
+	for _, keyword := range keywords {
+		if keyword.Token != "날씨가" && keyword.Token != "좋다" {
+			t.Errorf("keyword %q is not a word of the text", keyword.Token)
+		}
+	}
+}
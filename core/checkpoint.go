@@ -0,0 +1,196 @@
+package core
+
+import (
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+)
+
+// KindCheckpoint marks a training checkpoint written by TrainWithConfig.
+const KindCheckpoint ModelKind = "checkpoint"
+
+// trainState is the progress of a training run. Everything but bestWeights
+// is stored in checkpoints as is.
+type trainState struct {
+	NextEpoch int   // First epoch that has not run yet
+	Seed      int64 // Seeds the shuffle of every epoch, see epochRand
+	History   TrainHistory
+	Stopping  earlyStopping
+	Optimizer Optimizer // Carries momentum or Adam moments across a resume
+
+	bestWeights WeightMatrix // Weights of the best epoch when cfg.RestoreBest is set
+}
+
+func newTrainState(cfg TrainConfig) *trainState {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	optimizer := cfg.Optimizer
+	if optimizer == nil {
+		optimizer = &SGD{}
+	}
+	return &trainState{
+		Seed:      seed,
+		History:   TrainHistory{BestEpoch: -1},
+		Stopping:  newEarlyStopping(cfg),
+		Optimizer: optimizer,
+	}
+}
+
+// epochRand returns the source that shuffles epoch. Deriving it from the
+// seed and the epoch makes the random state of a run fully described by
+// Seed and NextEpoch, so a resumed run shuffles exactly like the original.
+func (s *trainState) epochRand(epoch int) *rand.Rand {
+	return rand.New(rand.NewSource(s.Seed + int64(epoch)))
+}
+
+func (c TrainConfig) checkpointEvery() int {
+	if c.CheckpointEvery <= 0 {
+		return 1
+	}
+	return c.CheckpointEvery
+}
+
+// writeCheckpoint saves the model and the training state to path. The file
+// is written next to path first and renamed, so an interrupted write never
+// destroys the previous checkpoint.
+func (m *LinearModel) writeCheckpoint(path string, state *trainState) error {
+	tmpPath := path + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	meta := m.Meta
+	meta.LearningRate = m.LearningRate
+	meta.Objective = m.Objective
+	_, err = writeModel(file, fileHeader{Kind: KindCheckpoint, Meta: meta}, m.Lexicon, m.Stats, func(encoder *gob.Encoder) error {
+		if err := encodeExactWeights(encoder, m.Weights); err != nil {
+			return err
+		}
+		if err := encoder.Encode(state); err != nil {
+			return err
+		}
+		if err := encoder.Encode(state.bestWeights != nil); err != nil {
+			return err
+		}
+		if state.bestWeights != nil {
+			return encodeExactWeights(encoder, state.bestWeights)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// encodeExactWeights writes the weights as float32 so a resumed run starts
+// from exactly where it stopped. A bool tells the layouts apart.
+func encodeExactWeights(encoder *gob.Encoder, weights WeightMatrix) error {
+	switch w := weights.(type) {
+	case DenseWeights:
+		if err := encoder.Encode(false); err != nil {
+			return err
+		}
+		return encoder.Encode(w)
+	case *SparseWeights:
+		if err := encoder.Encode(true); err != nil {
+			return err
+		}
+		return encoder.Encode(w)
+	default:
+		return fmt.Errorf("unsupported weight matrix %T", weights)
+	}
+}
+
+// decodeExactWeights reads weights written by encodeExactWeights.
+func decodeExactWeights(decoder *gob.Decoder) (WeightMatrix, error) {
+	var sparse bool
+	if err := decoder.Decode(&sparse); err != nil {
+		return nil, err
+	}
+	if sparse {
+		weights := &SparseWeights{}
+		err := decoder.Decode(weights)
+		return weights, err
+	}
+	var weights DenseWeights
+	err := decoder.Decode(&weights)
+	return weights, err
+}
+
+// readCheckpoint loads a checkpoint written by writeCheckpoint.
+func readCheckpoint(path string) (*LinearModel, *trainState, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	model := &LinearModel{}
+	state := &trainState{}
+	tokenizer, meta, err := readModel(file, KindCheckpoint, func(decoder *gob.Decoder, _ fileHeader) error {
+		weights, err := decodeExactWeights(decoder)
+		if err != nil {
+			return err
+		}
+		model.Weights = weights
+
+		if err := decoder.Decode(state); err != nil {
+			return err
+		}
+
+		var hasBest bool
+		if err := decoder.Decode(&hasBest); err != nil {
+			return err
+		}
+		if hasBest {
+			state.bestWeights, err = decodeExactWeights(decoder)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	model.Lexicon, model.Stats = tokenizer.Vocabulary, tokenizer.TransitionCounts
+	model.Meta = meta
+	model.LearningRate = meta.LearningRate
+	model.Objective = meta.Objective
+	return model, state, nil
+}
+
+// ResumeTraining continues a training run from the checkpoint at path until
+// cfg.Epochs. cfg should match the interrupted run; its Seed is replaced by
+// the one stored in the checkpoint so the remaining epochs shuffle the same
+// way, and the optimizer state stored in the checkpoint replaces
+// cfg.Optimizer. Further checkpoints are written as cfg asks. Only the
+// settings training uses are validated; the corpus split and tokenizer
+// settings are ignored.
+func ResumeTraining(path string, cfg TrainConfig, validation Transitions) (*LinearModel, TrainHistory, error) {
+	if err := cfg.validateTraining(); err != nil {
+		return nil, TrainHistory{}, err
+	}
+
+	model, state, err := readCheckpoint(path)
+	if err != nil {
+		return nil, TrainHistory{}, err
+	}
+
+	cfg.Seed = state.Seed
+	cfg.Optimizer = state.Optimizer
+	state.Stopping.Patience = cfg.Patience
+	state.Stopping.MinDelta = cfg.MinDelta
+	fmt.Printf("Resuming training at epoch %d...\n", state.NextEpoch)
+
+	history, err := model.train(cfg, validation, state)
+	return model, history, err
+}
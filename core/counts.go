@@ -0,0 +1,160 @@
+package core
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// TransitionStats gives read access to how often tokens follow each other.
+// *TransitionCounts and Transitions implement it.
+type TransitionStats interface {
+	// Successors returns how often each token followed token idx.
+	// The map must not be modified.
+	Successors(idx int) map[int]int
+	// ContextSuccessors returns how often each token followed the tokens of
+	// context, nil when the context was not counted. A context of one token
+	// is the same as Successors. The map must not be modified.
+	ContextSuccessors(context []int) map[int]int
+}
+
+// TransitionCounts stores how often each token follows another, and
+// optionally longer contexts, by token index.
+type TransitionCounts struct {
+	UnigramMap  map[int]int
+	UnigramFreq map[int]map[int]int    // Persisted for reward mechanism
+	NGramOrder  int                    // Longest n-gram counted by AddtoModel, 2 or less counts only UnigramFreq
+	ContextFreq map[string]map[int]int // Successor counts of contexts of 2 to NGramOrder-1 tokens, keyed by contextKey
+}
+
+// NewTransitionCounts creates an empty TransitionCounts.
+func NewTransitionCounts() *TransitionCounts {
+	return &TransitionCounts{
+		UnigramMap:  make(map[int]int),
+		UnigramFreq: make(map[int]map[int]int),
+		ContextFreq: make(map[string]map[int]int),
+	}
+}
+
+// Add counts one occurrence of nextIdx following tokIdx.
+func (c *TransitionCounts) Add(tokIdx, nextIdx int) {
+	if c.UnigramFreq[tokIdx] == nil {
+		c.UnigramFreq[tokIdx] = make(map[int]int)
+	}
+	c.UnigramFreq[tokIdx][nextIdx]++
+}
+
+func (c *TransitionCounts) Successors(idx int) map[int]int {
+	return c.UnigramFreq[idx]
+}
+
+func (c *TransitionCounts) ContextSuccessors(context []int) map[int]int {
+	switch {
+	case len(context) == 0:
+		return nil
+	case len(context) == 1:
+		return c.UnigramFreq[context[0]]
+	}
+	return c.ContextFreq[contextKey(context)]
+}
+
+// successorCounts collects the successors of the first size tokens of stats.
+func successorCounts(stats TransitionStats, size int) map[int]map[int]int {
+	freq := make(map[int]map[int]int)
+	for idx := 0; idx < size; idx++ {
+		if successors := stats.Successors(idx); len(successors) > 0 {
+			freq[idx] = successors
+		}
+	}
+	return freq
+}
+
+// mostFrequent returns the successor counted most often in freq, the lowest
+// index on ties, or -1 when freq is empty.
+func mostFrequent(freq map[int]int) int {
+	best, bestFreq := -1, 0
+	for nextID, count := range freq {
+		if count > bestFreq || count == bestFreq && nextID < best {
+			best, bestFreq = nextID, count
+		}
+	}
+	return best
+}
+
+// BuildUnigramMap iterates through the counts and selects the most frequent next token for each token.
+func (c *TransitionCounts) BuildUnigramMap() {
+	for tokID := range c.UnigramFreq {
+		c.updateUnigramMap(tokID)
+	}
+
+	// We no longer clear the frequency map to use it for rewards.
+	runtime.GC()
+}
+
+// updateUnigramMap selects the most frequent next token of tokID only,
+// for when just a few rows changed.
+func (c *TransitionCounts) updateUnigramMap(tokID int) {
+	maxFreq := 0
+	bestNextID := -1
+	for nextID, freq := range c.UnigramFreq[tokID] {
+		if freq > maxFreq {
+			maxFreq = freq
+			bestNextID = nextID
+		}
+	}
+	if bestNextID != -1 {
+		c.UnigramMap[tokID] = bestNextID
+	}
+}
+
+// addContexts counts the successors of every context of 2 to NGramOrder-1
+// tokens in the sequence indices.
+func (c *TransitionCounts) addContexts(indices []int) {
+	if c.ContextFreq == nil {
+		c.ContextFreq = make(map[string]map[int]int)
+	}
+
+	for n := 2; n < c.NGramOrder; n++ {
+		for i := n; i < len(indices); i++ {
+			key := contextKey(indices[i-n : i])
+			if c.ContextFreq[key] == nil {
+				c.ContextFreq[key] = make(map[int]int)
+			}
+			c.ContextFreq[key][indices[i]]++
+		}
+	}
+}
+
+// contextKey encodes a sequence of token indices as a ContextFreq key.
+func contextKey(indices []int) string {
+	parts := make([]string, len(indices))
+	for i, idx := range indices {
+		parts[i] = strconv.Itoa(idx)
+	}
+	return strings.Join(parts, " ")
+}
+
+// CountTransitions counts the transitions in texts without adding them to
+// lexicon. Words outside the vocabulary count as UNKTOKEN once the
+// lexicon was pruned; before that, pairs containing one are skipped.
+func CountTransitions(lexicon Lexicon, texts []string) Transitions {
+	transitions := make(Transitions)
+	for _, text := range texts {
+		words := append(append([]string{BOTTOKEN}, lexicon.Tokenize(text)...), ENDTOKEN)
+		for i := 0; i < len(words)-1; i++ {
+			tokIdx, ok := lookup(lexicon, words[i])
+			if !ok {
+				continue
+			}
+			nextIdx, ok := lookup(lexicon, words[i+1])
+			if !ok {
+				continue
+			}
+			if transitions[tokIdx] == nil {
+				transitions[tokIdx] = make(map[int]int)
+			}
+			transitions[tokIdx][nextIdx]++
+		}
+	}
+	return transitions
+}
@@ -2,82 +2,168 @@ package core
 
 import (
 	"encoding/gob"
+	"errors"
 	"fmt"
-	"math/rand"
+	"io"
 	"os"
+	"time"
 
 	"github.com/x448/float16"
 )
 
 // CreateAndTrainModel creates a tokenizer and a model from texts, trains the model,
 // and saves it to a file using gob binary format in a memory-efficient way.
+// It trains a dense model with the argmax objective on a random third of
+// the texts split on whitespace, and reports the losses on the other two
+// thirds; CreateAndTrainModelWithConfig offers the other settings.
 func CreateAndTrainModel(texts []string, learningRate float32, epochs int, savePath string) (*LinearModel, error) {
-	// Determine the split point for training data
-	rand.Shuffle(len(texts), func(i, j int) {
-		texts[i], texts[j] = texts[j], texts[i]
-	})
-
-	fmt.Printf("Using %d for training...\n", len(texts)/3)
-	texts = texts[:len(texts)/3]
+	return CreateAndTrainModelWithConfig(texts, legacyTrainConfig(learningRate, epochs), savePath)
+}
 
-	// 1. Create and build tokenizer using only training data
-	tokenizer := NewTokenizer()
-	for _, text := range texts {
-		tokenizer.AddtoModel(text)
+// CreateAndTrainModelWithConfig splits texts according to cfg, builds the
+// tokenizer from the training part, trains a model while reporting the
+// validation loss and saves it to savePath.
+func CreateAndTrainModelWithConfig(texts []string, cfg TrainConfig, savePath string) (*LinearModel, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
 	}
 
-	// 2. Build the final UnigramMap from frequency counts
-	fmt.Println("Building unigram map...")
-	tokenizer.BuildUnigramMap()
+	// 1. Split the corpus
+	train, validation, test := SplitCorpus(texts, cfg)
+	fmt.Printf("Using %d for training, %d for validation, %d for test...\n", len(train), len(validation), len(test))
+
+	// 2. Create and build tokenizer using only training data
+	tokenizer := buildTokenizer(train, cfg)
 
 	// 3. Create and train model with float32
-	model := NewLinearModel(tokenizer, learningRate)
+	var model *LinearModel
+	if cfg.SparseWeights {
+		model = NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, cfg.LearningRate)
+	} else {
+		model = NewLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, cfg.LearningRate)
+	}
+	model.Meta = newModelMeta(tokenizer, len(train), cfg)
 	fmt.Println("Training model...")
-	model.Train(epochs, 2048) // Using a batch size of 32
+	if _, err := model.TrainWithConfig(cfg, CountTransitions(tokenizer, validation)); err != nil {
+		return nil, err
+	}
+
+	if len(test) > 0 {
+		printEvaluation("Test", model.Evaluate(CountTransitions(tokenizer, test)))
+	}
 
 	// 4. Save to a binary file using gob, converting weights to float16 for storage
-	file, err := os.Create(savePath)
-	if err != nil {
+	fmt.Println("Saving weights...")
+	if err := SaveModel(model, savePath); err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
-	encoder := gob.NewEncoder(file)
+	fmt.Printf("Model created successfully from a total of %d sentences.", len(train))
+
+	return model, nil
+}
 
-	// Encode Tokenizer
-	if err := encoder.Encode(model.Tokenizer); err != nil {
+// CreateAndTrainEmbeddingModel is CreateAndTrainEmbeddingModelWithConfig
+// with DefaultTrainConfig and the given learning rate and epochs.
+func CreateAndTrainEmbeddingModel(texts []string, dim int, learningRate float32, epochs int, savePath string) (*EmbeddingModel, error) {
+	cfg := DefaultTrainConfig()
+	cfg.LearningRate = learningRate
+	cfg.Epochs = epochs
+	return CreateAndTrainEmbeddingModelWithConfig(texts, dim, cfg, savePath)
+}
+
+// CreateAndTrainEmbeddingModelWithConfig is CreateAndTrainModelWithConfig
+// for an EmbeddingModel of dimension dim.
+func CreateAndTrainEmbeddingModelWithConfig(texts []string, dim int, cfg TrainConfig, savePath string) (*EmbeddingModel, error) {
+	if err := cfg.validate(); err != nil {
 		return nil, err
 	}
+	if dim <= 0 {
+		return nil, errors.New("train config: embedding dimension must be positive")
+	}
 
-	// Encode Weights row by row after converting to float16
-	fmt.Println("Saving tokens...")
-	vocabSize := model.Tokenizer.Count
-	if err := encoder.Encode(vocabSize); err != nil {
+	train, validation, test := SplitCorpus(texts, cfg)
+	fmt.Printf("Using %d for training, %d for validation, %d for test...\n", len(train), len(validation), len(test))
+
+	tokenizer := buildTokenizer(train, cfg)
+
+	model := NewEmbeddingModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, dim, cfg.LearningRate)
+	model.Meta = newModelMeta(tokenizer, len(train), cfg)
+	model.Meta.Dim = dim
+	fmt.Println("Training model...")
+	if _, err := model.TrainWithConfig(cfg, CountTransitions(tokenizer, validation)); err != nil {
 		return nil, err
 	}
 
-	fmt.Println("Saving weights...")
-	weightsF16 := make([][]float16.Float16, vocabSize)
-	for i := 0; i < vocabSize; i++ {
-		weightsF16[i] = make([]float16.Float16, vocabSize)
-		for j := 0; j < vocabSize; j++ {
-			weightsF16[i][j] = float16.Fromfloat32(model.Weights[i][j])
-		}
-		if i%1000 == 0 {
-			fmt.Printf("%d / %d\n", i, vocabSize)
-		}
-		if err := encoder.Encode(weightsF16[i]); err != nil {
-			return nil, err
-		}
+	if len(test) > 0 {
+		printEvaluation("Test", model.Evaluate(CountTransitions(tokenizer, test)))
 	}
 
-	fmt.Printf("Model created successfully from a total of %d sentences.", len(texts))
+	fmt.Println("Saving embeddings...")
+	if err := SaveModel(model, savePath); err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Model created successfully from a total of %d sentences.", len(train))
 
 	return model, nil
 }
 
+// SaveModel writes model to savePath. Any model implementing io.WriterTo
+// (LinearModel, EmbeddingModel, NGramModel) can be saved. The file is
+// replaced only once it is completely written, so a running bot can save
+// over the model it was started from.
+func SaveModel(model io.WriterTo, savePath string) error {
+	tmpPath := savePath + ".tmp"
+	file, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if _, err := model.WriteTo(file); err != nil {
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, savePath)
+}
+
+// WriteTo writes the model to w in the model file format,
+// converting weights to float16 for storage.
+func (m *LinearModel) WriteTo(w io.Writer) (int64, error) {
+	header := fileHeader{Kind: KindLinear, Meta: m.Meta, Layout: weightLayout(m.Weights)}
+	return writeModel(w, header, m.Lexicon, m.Stats, func(encoder *gob.Encoder) error {
+		// Encode Weights row by row after converting to float16
+		return encodeWeights(encoder, m.Weights)
+	})
+}
+
+// WriteTo writes the model to w in the model file format,
+// converting the embeddings to float16 for storage.
+func (m *EmbeddingModel) WriteTo(w io.Writer) (int64, error) {
+	return writeModel(w, fileHeader{Kind: KindEmbedding, Meta: m.Meta}, m.Lexicon, m.Stats, func(encoder *gob.Encoder) error {
+		return encodeEmbeddings(encoder, m)
+	})
+}
+
+// WriteTo writes the model to w in the model file format.
+// All counts live in the tokenizer, so only the order follows it.
+func (m *NGramModel) WriteTo(w io.Writer) (int64, error) {
+	tokenizer, err := tokenizerOf(m.Lexicon, m.Stats)
+	if err != nil {
+		return 0, err
+	}
+	meta := ModelMeta{CreatedAt: time.Now().UTC(), NGramOrder: tokenizer.NGramOrder}
+	return writeModel(w, fileHeader{Kind: KindNGram, Meta: meta}, tokenizer, tokenizer, func(encoder *gob.Encoder) error {
+		return encoder.Encode(m.Order)
+	})
+}
+
 // LoadModel loads a model and tokenizer from a gob binary file,
 // converting float16 weights to float32 for use in the model.
+// learningRate is used for further training; 0 keeps the rate stored in the file.
 func LoadModel(loadPath string, learningRate float32) (*LinearModel, error) {
 	// 1. Open binary file
 	file, err := os.Open(loadPath)
@@ -86,38 +172,317 @@ func LoadModel(loadPath string, learningRate float32) (*LinearModel, error) {
 	}
 	defer file.Close()
 
-	decoder := gob.NewDecoder(file)
+	// 2. Decode Tokenizer and Weights
+	model, err := ReadModel(file)
+	if err != nil {
+		return nil, err
+	}
+	if learningRate != 0 {
+		model.LearningRate = learningRate
+	}
+
+	return model, nil
+}
+
+// ReadModel reads a LinearModel written by WriteTo.
+// The header is validated and one of ErrBadMagic, ErrCorrupt, ErrChecksum,
+// *VersionError or *KindError is returned for invalid input.
+func ReadModel(r io.Reader) (*LinearModel, error) {
+	model := &LinearModel{}
+
+	tokenizer, meta, err := readModel(r, KindLinear, func(decoder *gob.Decoder, header fileHeader) error {
+		// Decode Weights row by row (as float16)
+		weights, err := decodeWeights(decoder, header.Layout)
+		model.Weights = weights
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	model.Lexicon, model.Stats = tokenizer.Vocabulary, tokenizer.TransitionCounts
+	model.Meta = meta
+	model.LearningRate = meta.LearningRate
+	model.Objective = meta.Objective
+
+	return model, nil
+}
+
+// LoadEmbeddingModel loads an EmbeddingModel saved by SaveModel.
+// learningRate is used for further training; 0 keeps the rate stored in the file.
+func LoadEmbeddingModel(loadPath string, learningRate float32) (*EmbeddingModel, error) {
+	file, err := os.Open(loadPath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	model, err := ReadEmbeddingModel(file)
+	if err != nil {
+		return nil, err
+	}
+	if learningRate != 0 {
+		model.LearningRate = learningRate
+	}
+
+	return model, nil
+}
+
+// ReadEmbeddingModel reads an EmbeddingModel written by WriteTo.
+// It validates the input like ReadModel.
+func ReadEmbeddingModel(r io.Reader) (*EmbeddingModel, error) {
+	model := &EmbeddingModel{}
+
+	tokenizer, meta, err := readModel(r, KindEmbedding, func(decoder *gob.Decoder, _ fileHeader) error {
+		return decodeEmbeddings(decoder, model)
+	})
+	if err != nil {
+		return nil, err
+	}
+	model.Lexicon, model.Stats = tokenizer.Vocabulary, tokenizer.TransitionCounts
+	model.Meta = meta
+	model.LearningRate = meta.LearningRate
+	model.Objective = meta.Objective
+
+	return model, nil
+}
 
-	// 2. Decode Tokenizer
-	var tokenizer Tokenizer
-	if err := decoder.Decode(&tokenizer); err != nil {
+// ReadNGramModel reads an NGramModel written by WriteTo.
+// It validates the input like ReadModel.
+func ReadNGramModel(r io.Reader) (*NGramModel, error) {
+	var order int
+	tokenizer, _, err := readModel(r, KindNGram, func(decoder *gob.Decoder, _ fileHeader) error {
+		return decoder.Decode(&order)
+	})
+	if err != nil {
 		return nil, err
 	}
 
-	// 3. Decode Weights row by row (as float16)
+	return NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, order), nil
+}
+
+// buildTokenizer builds a tokenizer from the training texts, pruned
+// according to cfg.
+func buildTokenizer(texts []string, cfg TrainConfig) *Tokenizer {
+	tokenizer := NewNGramTokenizer(cfg.NGramOrder)
+	tokenizer.PreTokenizer = cfg.PreTokenizer
+	tokenizer.Normalizer = cfg.Normalizer
+	if cfg.BPEMerges > 0 {
+		fmt.Println("Learning subwords...")
+		normalized := make([]string, len(texts))
+		for i, text := range texts {
+			normalized[i] = cfg.Normalizer.Normalize(text)
+		}
+		tokenizer.UseBPE(TrainBPE(normalized, cfg.BPEMerges))
+	}
+	for _, text := range texts {
+		tokenizer.AddtoModel(text)
+	}
+
+	// Build the final UnigramMap from frequency counts
+	fmt.Println("Building unigram map...")
+	tokenizer.BuildUnigramMap()
+
+	if cfg.BPEMerges == 0 && (cfg.MinCount > 1 || cfg.MaxVocab > 0) {
+		removed := tokenizer.Prune(cfg.MinCount, cfg.MaxVocab)
+		fmt.Printf("Pruned %d rare tokens, %d left...\n", removed, tokenizer.Count)
+	}
+
+	return tokenizer
+}
+
+// newModelMeta records the settings a model was trained with.
+func newModelMeta(tokenizer *Tokenizer, corpusSize int, cfg TrainConfig) ModelMeta {
+	return ModelMeta{
+		CreatedAt:    time.Now().UTC(),
+		CorpusSize:   corpusSize,
+		Epochs:       cfg.Epochs,
+		LearningRate: cfg.LearningRate,
+		Objective:    cfg.Objective,
+		NGramOrder:   tokenizer.NGramOrder,
+	}
+}
+
+// sparseRowF16 is the on-disk form of a SparseRow.
+type sparseRowF16 struct {
+	Cols []int32
+	Vals []float16.Float16
+}
+
+// weightLayout returns the layout weights are stored in, see encodeWeights.
+func weightLayout(weights WeightMatrix) WeightLayout {
+	if _, ok := weights.(*SparseWeights); ok {
+		return LayoutSparse
+	}
+	return LayoutDense
+}
+
+// encodeWeights writes the vocabulary size followed by one float16 row at a
+// time. The layout is not written; the file header records it.
+func encodeWeights(encoder *gob.Encoder, weights WeightMatrix) error {
+	vocabSize := weights.Size()
+	if err := encoder.Encode(vocabSize); err != nil {
+		return err
+	}
+
+	switch w := weights.(type) {
+	case DenseWeights:
+		rowF16 := make([]float16.Float16, vocabSize)
+		for i := 0; i < vocabSize; i++ {
+			for j := 0; j < vocabSize; j++ {
+				rowF16[j] = float16.Fromfloat32(w[i][j])
+			}
+			if i%1000 == 0 {
+				fmt.Printf("%d / %d\n", i, vocabSize)
+			}
+			if err := encoder.Encode(rowF16); err != nil {
+				return err
+			}
+		}
+	case *SparseWeights:
+		for i := 0; i < vocabSize; i++ {
+			row := w.Rows[i]
+			rowF16 := sparseRowF16{Cols: row.Cols, Vals: make([]float16.Float16, len(row.Vals))}
+			for k, v := range row.Vals {
+				rowF16.Vals[k] = float16.Fromfloat32(v)
+			}
+			if i%1000 == 0 {
+				fmt.Printf("%d / %d\n", i, vocabSize)
+			}
+			if err := encoder.Encode(rowF16); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("unsupported weight matrix %T", weights)
+	}
+	return nil
+}
+
+// decodeWeights reads a matrix written by encodeWeights in the given layout,
+// converting float16 to float32. Files from before format version 3 have no
+// layout and mark sparse matrices by a negative size.
+func decodeWeights(decoder *gob.Decoder, layout WeightLayout) (WeightMatrix, error) {
 	var vocabSize int
 	if err := decoder.Decode(&vocabSize); err != nil {
 		return nil, err
 	}
+	if layout == "" {
+		layout = LayoutDense
+		if vocabSize < 0 {
+			layout, vocabSize = LayoutSparse, -vocabSize
+		}
+	}
+	if vocabSize < 0 {
+		return nil, fmt.Errorf("negative vocabulary size %d", vocabSize)
+	}
+	if layout != LayoutDense && layout != LayoutSparse {
+		return nil, fmt.Errorf("unknown weight layout %q", layout)
+	}
 
-	weightsF32 := make([][]float32, vocabSize)
+	if layout == LayoutSparse {
+		weights := &SparseWeights{Rows: make([]SparseRow, vocabSize), N: vocabSize}
+		for i := 0; i < vocabSize; i++ {
+			var rowF16 sparseRowF16
+			if err := decoder.Decode(&rowF16); err != nil {
+				return nil, err
+			}
+			vals := make([]float32, len(rowF16.Vals))
+			for k, v := range rowF16.Vals {
+				vals[k] = v.Float32()
+			}
+			if len(vals) != len(rowF16.Cols)+1 {
+				return nil, fmt.Errorf("sparse row %d: %d values for %d columns", i, len(vals), len(rowF16.Cols))
+			}
+			weights.Rows[i] = SparseRow{Cols: rowF16.Cols, Vals: vals}
+		}
+		return weights, nil
+	}
+
+	weights := make(DenseWeights, vocabSize)
 	weightsF16Row := make([]float16.Float16, vocabSize)
 	for i := 0; i < vocabSize; i++ {
 		if err := decoder.Decode(&weightsF16Row); err != nil {
 			return nil, err
 		}
-		weightsF32[i] = make([]float32, vocabSize)
+		weights[i] = make([]float32, vocabSize)
 		for j := 0; j < vocabSize; j++ {
-			weightsF32[i][j] = weightsF16Row[j].Float32()
+			weights[i][j] = weightsF16Row[j].Float32()
 		}
 	}
+	return weights, nil
+}
 
-	// 4. Create and populate model with float32 weights
-	model := &LinearModel{
-		Weights:      weightsF32,
-		Tokenizer:    &tokenizer,
-		LearningRate: learningRate,
+// embeddingHeader precedes the rows of an EmbeddingModel on disk.
+type embeddingHeader struct {
+	VocabSize int
+	Dim       int
+}
+
+// encodeEmbeddings writes the input and output tables row by row as float16,
+// followed by the output bias.
+func encodeEmbeddings(encoder *gob.Encoder, model *EmbeddingModel) error {
+	if err := encoder.Encode(embeddingHeader{VocabSize: len(model.Input), Dim: model.Dim}); err != nil {
+		return err
+	}
+	for _, table := range [][][]float32{model.Input, model.Output} {
+		for _, row := range table {
+			if err := encoder.Encode(toFloat16(row)); err != nil {
+				return err
+			}
+		}
 	}
+	return encoder.Encode(toFloat16(model.Bias))
+}
 
-	return model, nil
+// decodeEmbeddings reads the tables written by encodeEmbeddings into model.
+func decodeEmbeddings(decoder *gob.Decoder, model *EmbeddingModel) error {
+	var header embeddingHeader
+	if err := decoder.Decode(&header); err != nil {
+		return err
+	}
+	model.Dim = header.Dim
+
+	var rowF16 []float16.Float16
+	readTable := func() ([][]float32, error) {
+		table := make([][]float32, header.VocabSize)
+		for i := range table {
+			if err := decoder.Decode(&rowF16); err != nil {
+				return nil, err
+			}
+			if len(rowF16) != header.Dim {
+				return nil, fmt.Errorf("embedding row %d has %d values, want %d", i, len(rowF16), header.Dim)
+			}
+			table[i] = toFloat32(rowF16)
+		}
+		return table, nil
+	}
+
+	var err error
+	if model.Input, err = readTable(); err != nil {
+		return err
+	}
+	if model.Output, err = readTable(); err != nil {
+		return err
+	}
+	if err := decoder.Decode(&rowF16); err != nil {
+		return err
+	}
+	model.Bias = toFloat32(rowF16)
+	return nil
+}
+
+func toFloat16(row []float32) []float16.Float16 {
+	out := make([]float16.Float16, len(row))
+	for i, v := range row {
+		out[i] = float16.Fromfloat32(v)
+	}
+	return out
+}
+
+func toFloat32(row []float16.Float16) []float32 {
+	out := make([]float32, len(row))
+	for i, v := range row {
+		out[i] = v.Float32()
+	}
+	return out
 }
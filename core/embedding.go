@@ -0,0 +1,228 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"time"
+)
+
+// EmbeddingModel predicts the next token from a low-rank factorization of the
+// transition matrix: the score of j following i is Output[j]·Input[i] + Bias[j].
+// Memory grows with vocab x Dim instead of vocab squared, and tokens with
+// similar embeddings share similar successors.
+type EmbeddingModel struct {
+	Input        [][]float32 // vocab x Dim, embedding of the current token
+	Output       [][]float32 // vocab x Dim, projection of each candidate successor
+	Bias         []float32   // vocab, prior score of each successor
+	Dim          int
+	LearningRate float32
+	Lexicon      Lexicon
+	Stats        TransitionStats
+	Sampling     *SamplingConfig // nil means greedy decoding
+	Objective    TrainObjective
+	Meta         ModelMeta // How the model was created, stored in the file header
+}
+
+// NewEmbeddingModel creates and initializes a new EmbeddingModel of
+// dimension dim, trained on the successor counts in stats of the tokens of
+// lexicon.
+func NewEmbeddingModel(lexicon Lexicon, stats TransitionStats, dim int, learningRate float32) *EmbeddingModel {
+	rand.Seed(time.Now().UnixNano())
+	vocabSize := lexicon.Size()
+	scale := float32(1.0 / math.Sqrt(float64(dim)))
+
+	newTable := func() [][]float32 {
+		table := make([][]float32, vocabSize)
+		for i := range table {
+			table[i] = make([]float32, dim)
+			for j := range table[i] {
+				table[i][j] = randomInit() * scale
+			}
+		}
+		return table
+	}
+
+	return &EmbeddingModel{
+		Input:        newTable(),
+		Output:       newTable(),
+		Bias:         make([]float32, vocabSize),
+		Dim:          dim,
+		LearningRate: learningRate,
+		Lexicon:      lexicon,
+		Stats:        stats,
+	}
+}
+
+// scores writes the score of every successor of currentTokenIndex into dst.
+func (m *EmbeddingModel) scores(currentTokenIndex int, dst []float32) []float32 {
+	dst = resize(dst, len(m.Output))
+	in := m.Input[currentTokenIndex]
+	for j, out := range m.Output {
+		s := m.Bias[j]
+		for k, v := range in {
+			s += v * out[k]
+		}
+		dst[j] = s
+	}
+	return dst
+}
+
+// Predict predicts the next token index given the current token index.
+// The token is chosen according to m.Sampling, whose penalties are computed
+// from generatedTokens.
+func (m *EmbeddingModel) Predict(currentTokenIndex int, generatedTokens []int) int {
+	if currentTokenIndex < 0 || currentTokenIndex >= len(m.Input) {
+		return m.Sampling.intn(m.Lexicon.Size()) // Out of bounds safety
+	}
+
+	scores := m.scores(currentTokenIndex, nil)
+	maskSpecial(m.Lexicon, scores)
+	return m.Sampling.Sample(scores, withCurrent(currentTokenIndex, generatedTokens))
+}
+
+// Train trains the model with stochastic gradient descent over full softmax rows.
+// Unlike LinearModel the output table is shared between rows, so updates are
+// applied one token at a time.
+func (m *EmbeddingModel) Train(epochs int, batchSize int) {
+	// Use TrainWithConfig to learn about the losses or a diverged run.
+	_, _ = m.TrainWithConfig(TrainConfig{
+		LearningRate: m.LearningRate,
+		Epochs:       epochs,
+		BatchSize:    batchSize,
+		Objective:    m.Objective,
+	}, nil)
+}
+
+// TrainWithConfig trains the model like Train with the learning rate,
+// schedule, objective, epochs and seed of cfg. When validation is not empty,
+// it is evaluated after every epoch, and training stops early and restores
+// the best embeddings as cfg asks. The statistics of each epoch are passed
+// to cfg.OnEpoch and returned as the history. Updates are applied one token
+// at a time with plain SGD, so cfg.BatchSize, Optimizer and Workers have no
+// effect, and no checkpoints are written. The only error is ErrDiverged,
+// returned like LinearModel.TrainWithConfig does.
+func (m *EmbeddingModel) TrainWithConfig(cfg TrainConfig, validation Transitions) (TrainHistory, error) {
+	m.LearningRate = cfg.LearningRate
+	m.Objective = cfg.Objective
+	history := TrainHistory{BestEpoch: -1}
+	if len(m.Input) == 0 {
+		return history, nil // Cannot train on an empty vocabulary
+	}
+
+	// In order so the shuffle only depends on the seed
+	tokenIndices := trainingRows(m.Stats, len(m.Input))
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	schedule := cfg.schedule()
+	stopping := newEarlyStopping(cfg)
+	var best *embeddingTables
+
+	var scores []float32
+	dInput := make([]float32, m.Dim)
+	for epoch := 0; epoch < cfg.Epochs; epoch++ {
+		rate := schedule.Rate(cfg.LearningRate, epoch, cfg.Epochs)
+		runtime.GC()
+		fmt.Printf("Epoch: %d ", epoch)
+
+		// Shuffle the training data for each epoch
+		rng.Shuffle(len(tokenIndices), func(i, j int) {
+			tokenIndices[i], tokenIndices[j] = tokenIndices[j], tokenIndices[i]
+		})
+
+		totalLoss := 0.0
+		for _, currentTokenIndex := range tokenIndices {
+			scores = m.scores(currentTokenIndex, scores)
+			dScores := softmax(scores)
+			for j, t := range trainingTarget(m.Stats, m.Objective, currentTokenIndex) {
+				totalLoss -= float64(t * safeLog(dScores[j]))
+				dScores[j] -= t
+			}
+
+			// Backpropagate into the input embedding, the output table and the bias.
+			in := m.Input[currentTokenIndex]
+			for k := range dInput {
+				dInput[k] = 0
+			}
+			for j, d := range dScores {
+				out := m.Output[j]
+				for k := range out {
+					dInput[k] += d * out[k]
+					out[k] -= rate * d * in[k]
+				}
+				m.Bias[j] -= rate * d
+			}
+			for k := range in {
+				in[k] -= rate * dInput[k]
+			}
+		}
+
+		stats := EpochStats{Epoch: epoch, LearningRate: rate}
+		if len(tokenIndices) > 0 {
+			stats.TrainLoss = float32(totalLoss / float64(len(tokenIndices)))
+		}
+		if len(validation) > 0 {
+			stats.Validation = m.Evaluate(validation)
+		}
+		history.Epochs = append(history.Epochs, stats)
+		printEpochStats(stats, len(validation) > 0)
+		if cfg.OnEpoch != nil {
+			cfg.OnEpoch(stats)
+		}
+		if err := checkDiverged(stats, len(validation) > 0); err != nil {
+			if best != nil {
+				m.Input, m.Output, m.Bias = best.input, best.output, best.bias
+			}
+			return history, err
+		}
+
+		if len(validation) > 0 {
+			if stopping.observe(epoch, stats.Validation.Loss) && cfg.RestoreBest {
+				best = m.copyTables()
+			}
+			history.BestEpoch = stopping.BestEpoch
+			if stopping.stop() {
+				fmt.Printf("Stopping early, no improvement since epoch %d.\n", stopping.BestEpoch)
+				history.StoppedEarly = true
+				break
+			}
+		}
+	}
+
+	if best != nil {
+		m.Input, m.Output, m.Bias = best.input, best.output, best.bias
+	}
+	return history, nil
+}
+
+// embeddingTables holds a copy of the trained parameters of an EmbeddingModel.
+type embeddingTables struct {
+	input, output [][]float32
+	bias          []float32
+}
+
+// copyTables returns a deep copy of the model's parameters.
+func (m *EmbeddingModel) copyTables() *embeddingTables {
+	copyTable := func(table [][]float32) [][]float32 {
+		clone := make([][]float32, len(table))
+		for i, row := range table {
+			clone[i] = append([]float32(nil), row...)
+		}
+		return clone
+	}
+	return &embeddingTables{
+		input:  copyTable(m.Input),
+		output: copyTable(m.Output),
+		bias:   append([]float32(nil), m.Bias...),
+	}
+}
+
+// Evaluate returns the loss, perplexity and accuracy of the model on data.
+func (m *EmbeddingModel) Evaluate(data Transitions) Evaluation {
+	return evaluate(m.scores, len(m.Input), data)
+}
@@ -4,6 +4,7 @@ import (
 	"regexp"
 	"sort"
 	"strings"
+	"unicode"
 )
 
 // Keyword represents a token and its importance score.
@@ -21,51 +22,70 @@ func (a byScore) Less(i, j int) bool { return a[i].Score < a[j].Score }
 
 // Extractor finds important keywords in a text.
 type Extractor struct {
-	tokenizer *Tokenizer
+	lexicon Lexicon
+	stats   TransitionStats
 }
 
-// NewExtractor creates a new Extractor.
-func NewExtractor(model *LinearModel) *Extractor {
+// NewExtractor creates a new Extractor using the model's lexicon and stats.
+func NewExtractor(model Predictor) *Extractor {
+	return NewStatsExtractor(model.GetLexicon(), model.GetStats())
+}
+
+// NewStatsExtractor creates an Extractor that splits text with lexicon and
+// favors words followed by few distinct tokens in stats.
+func NewStatsExtractor(lexicon Lexicon, stats TransitionStats) *Extractor {
 	return &Extractor{
-		tokenizer: model.Tokenizer,
+		lexicon: lexicon,
+		stats:   stats,
 	}
 }
 
 // Extract returns a sorted list of keywords from the input text.
 // topK specifies the number of keywords to return. If topK <= 0, all keywords are returned.
 func (e *Extractor) Extract(rawInput string, topK int) []Keyword {
-	input := filterString(rawInput)
-	tokens := strings.Fields(input)
+	input := cleanText(e.lexicon, rawInput)
+	tokens := e.lexicon.Tokenize(input)
 
 	if len(tokens) == 0 {
 		return []Keyword{}
 	}
 
-	// Calculate term frequencies in the current text.
+	// Calculate term frequencies in the current text. Subwords and particles
+	// are joined back into the word they belong to, which is scored by all
+	// of its tokens.
 	tf := make(map[string]int)
-	for _, token := range tokens {
-		tf[token]++
+	pieces := make(map[string][]string)
+	for start := 0; start < len(tokens); {
+		end := start + 1
+		for end < len(tokens) && strings.HasPrefix(tokens[end], SuffixMarker) {
+			end++
+		}
+		word := e.lexicon.Detokenize(tokens[start:end])
+		tf[word]++
+		pieces[word] = tokens[start:end]
+		start = end
 	}
 
 	var candidates []Keyword
 	for token, freq := range tf {
-		// Filter short words
-		if len([]rune(token)) < 2 {
+		// Filter short words and words without letters, like punctuation and emoji
+		if len([]rune(token)) < 2 || !strings.ContainsFunc(token, isWordRune) {
 			continue
 		}
 
-		tokIdx, exists := e.tokenizer.GetTokenIndex(token)
-
 		// Base score from word length
 		score := float32(len([]rune(token)))
 
-		// Add specificity bonus
-		if exists {
-			if nextTokens, ok := e.tokenizer.UnigramFreq[tokIdx]; ok && len(nextTokens) > 0 {
-				specificity := 1.0 / float32(len(nextTokens))
-				score += specificity * 5.0 // Weight for specificity
+		// Add specificity bonus, averaged over the tokens of the word
+		var specificity float32
+		for _, piece := range pieces[token] {
+			if tokIdx, exists := e.lexicon.GetTokenIndex(piece); exists {
+				if nextTokens := e.stats.Successors(tokIdx); len(nextTokens) > 0 {
+					specificity += 1.0 / float32(len(nextTokens))
+				}
 			}
 		}
+		score += specificity / float32(len(pieces[token])) * 5.0 // Weight for specificity
 
 		// Penalize by frequency in the current text
 		finalScore := score / float32(freq)
@@ -82,7 +102,47 @@ func (e *Extractor) Extract(rawInput string, topK int) []Keyword {
 	return candidates
 }
 
-// filterString cleans the input string by removing HTML tags, links, mentions, and punctuation.
+// CleanText cleans a post the way Extract does for a model with lexicon and
+// collapses its whitespace, so it can be passed to LinearModel.Learn.
+func CleanText(lexicon Lexicon, input string) string {
+	return strings.Join(strings.Fields(cleanText(lexicon, input)), " ")
+}
+
+// cleanText cleans input with filterString. Lexicons without a Normalizer,
+// like those of models saved before it existed or built by
+// CreateAndTrainModel, also get the lowercasing extraction always did, and
+// punctuation is removed unless the Normalizer splits it into tokens of its
+// own, so "안녕!" still matches the token "안녕".
+func cleanText(lexicon Lexicon, input string) string {
+	input = filterString(input)
+	normalizer := lexiconNormalizer(lexicon)
+	if !normalizer.SplitPunctuation {
+		input = removePunctuation.ReplaceAllString(input, "")
+	}
+	if normalizer == (Normalizer{}) {
+		input = strings.ToLower(input)
+	}
+	return input
+}
+
+// removePunctuation matches the punctuation that might interfere with
+// tokenization when the lexicon does not split it off.
+var removePunctuation = regexp.MustCompile(`[.,!?;:'"()[\]{}]`)
+
+// lexiconNormalizer returns the Normalizer lexicon applies before splitting
+// text, the zero value when it is not a Vocabulary.
+func lexiconNormalizer(lexicon Lexicon) Normalizer {
+	switch v := lexicon.(type) {
+	case *Vocabulary:
+		return v.Normalizer
+	case *Tokenizer:
+		return v.Normalizer
+	}
+	return Normalizer{}
+}
+
+// filterString cleans the input string by removing HTML tags, links and mentions.
+// Punctuation, case and Unicode forms are left to the tokenizer's Normalizer.
 func filterString(input string) string {
 	// Remove HTML tags
 	re := regexp.MustCompile(`<[^>]*>`)
@@ -96,10 +156,10 @@ func filterString(input string) string {
 	removeMention := regexp.MustCompile(`\B@\w+`)
 	input = removeMention.ReplaceAllString(input, "")
 
-	// Remove common punctuation that might interfere with tokenization.
-	removePunctuation := regexp.MustCompile(`[.,!?;:'"()[\]{}]`)
-	input = removePunctuation.ReplaceAllString(input, "")
+	return strings.TrimSpace(input)
+}
 
-	// Normalize to lowercase and trim space
-	return strings.TrimSpace(strings.ToLower(input))
-}
\ No newline at end of file
+// isWordRune reports whether r is a letter or a digit.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,41 @@
+package core
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestStatsExtractorUsesSuccessorCounts(t *testing.T) {
+	vocab := NewVocabulary()
+	common, rare := vocab.addWord("사람들"), vocab.addWord("고양이")
+	stats := Transitions{
+		common: {0: 1, 1: 1, 2: 1, 3: 1},
+		rare:   {0: 1},
+	}
+
+	keywords := NewStatsExtractor(vocab, stats).Extract("사람들 고양이", 1)
+	if len(keywords) != 1 || keywords[0].Token != "고양이" {
+		t.Errorf("Extract = %v, want 고양이, the word with fewer distinct successors", keywords)
+	}
+}
+
+func TestExtractorCleansWithoutNormalizer(t *testing.T) {
+	// Like CreateAndTrainModel and models saved before Normalizer existed
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("hello 안녕 world")
+	tokenizer.BuildUnigramMap()
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 2)
+
+	var words []string
+	for _, keyword := range NewExtractor(model).Extract("Hello 안녕!", 0) {
+		words = append(words, keyword.Token)
+	}
+	sort.Strings(words)
+	if want := []string{"hello", "안녕"}; !reflect.DeepEqual(words, want) {
+		t.Errorf("Extract = %q, want %q", words, want)
+	}
+	if got := CleanText(tokenizer, "<p>Hello, 안녕!</p>"); got != "hello 안녕" {
+		t.Errorf("CleanText = %q, want lowercase without punctuation", got)
+	}
+}
@@ -0,0 +1,310 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Model files start with FileMagic and a big-endian uint16 format version,
+// followed by a gob stream holding a fileHeader, the Tokenizer and the
+// model body. A big-endian CRC-32 (IEEE) of the gob stream ends the file.
+//
+// Version 2 stores the Tokenizer as its Vocabulary and TransitionCounts;
+// version 1 files, which store it as one flat struct, can still be read.
+// Version 3 records the layout of LinearModel weights in the header; older
+// files store the vocabulary size of sparse weights negated instead.
+const (
+	FileMagic     = "RSBM"
+	FormatVersion = 3
+)
+
+// minFormatVersion is the oldest format version that can be read.
+const minFormatVersion = 1
+
+// ModelKind identifies the model stored in a file.
+type ModelKind string
+
+const (
+	KindLinear    ModelKind = "linear"
+	KindEmbedding ModelKind = "embedding"
+	KindNGram     ModelKind = "ngram"
+)
+
+var (
+	// ErrBadMagic is returned for files that are neither a model file nor
+	// a readable file from before the header was introduced.
+	ErrBadMagic = errors.New("not a model file")
+	// ErrCorrupt is returned when a model file cannot be decoded.
+	ErrCorrupt = errors.New("corrupt model file")
+	// ErrChecksum is returned when the stored checksum does not match the contents.
+	ErrChecksum = errors.New("model file checksum mismatch")
+)
+
+// VersionError is returned for files written with an unsupported format version.
+type VersionError struct {
+	Version uint16
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("unsupported model file version %d (supported: %d to %d)", e.Version, minFormatVersion, FormatVersion)
+}
+
+// KindError is returned when a file holds a different kind of model than requested.
+type KindError struct {
+	Want, Got ModelKind
+}
+
+func (e *KindError) Error() string {
+	return fmt.Sprintf("model file holds a %s model, not %s", e.Got, e.Want)
+}
+
+// ModelMeta records how a model was created.
+type ModelMeta struct {
+	CreatedAt    time.Time
+	CorpusSize   int // Number of sentences the model was trained on
+	Epochs       int
+	LearningRate float32
+	Objective    TrainObjective
+	Dim          int // Embedding dimension, EmbeddingModel only
+	NGramOrder   int // Longest n-gram counted by the tokenizer
+}
+
+// WeightLayout is how the weights of a LinearModel are stored.
+type WeightLayout string
+
+const (
+	LayoutDense  WeightLayout = "dense"
+	LayoutSparse WeightLayout = "sparse"
+)
+
+// fileHeader is the first gob value of a model file.
+type fileHeader struct {
+	Kind   ModelKind
+	Meta   ModelMeta
+	Layout WeightLayout // LinearModel weights only, empty before version 3
+}
+
+// writeModel writes the header, the tokenizer made of lexicon and stats and
+// whatever encodeBody writes, followed by the checksum. It returns the
+// number of bytes written, and ErrUnsupportedTokenizer without writing
+// anything when lexicon and stats are not those of a Tokenizer.
+func writeModel(dst io.Writer, header fileHeader, lexicon Lexicon, stats TransitionStats, encodeBody func(*gob.Encoder) error) (int64, error) {
+	tokenizer, err := tokenizerOf(lexicon, stats)
+	if err != nil {
+		return 0, err
+	}
+
+	counter := &countingWriter{w: dst}
+	w := bufio.NewWriter(counter)
+
+	// Magic and version are written raw so they can be checked without gob.
+	var prefix [6]byte
+	copy(prefix[:4], FileMagic)
+	binary.BigEndian.PutUint16(prefix[4:], FormatVersion)
+	if _, err := w.Write(prefix[:]); err != nil {
+		return counter.n, err
+	}
+
+	crc := crc32.NewIEEE()
+	encoder := gob.NewEncoder(io.MultiWriter(w, crc))
+
+	if err := encoder.Encode(header); err != nil {
+		return counter.n, err
+	}
+
+	// Encode Tokenizer
+	if err := encoder.Encode(tokenizer); err != nil {
+		return counter.n, err
+	}
+
+	if err := encodeBody(encoder); err != nil {
+		return counter.n, err
+	}
+
+	if err := binary.Write(w, binary.BigEndian, crc.Sum32()); err != nil {
+		return counter.n, err
+	}
+	err = w.Flush()
+	return counter.n, err
+}
+
+// readModel validates the header against kind, decodes the tokenizer and
+// hands the rest of the stream to decodeBody along with the header.
+// Streams written before the header existed are read as legacy files,
+// whose header is empty.
+func readModel(src io.Reader, kind ModelKind, decodeBody func(*gob.Decoder, fileHeader) error) (*Tokenizer, ModelMeta, error) {
+	r := bufio.NewReader(src)
+
+	// 1. Check magic and version
+	magic, err := r.Peek(len(FileMagic))
+	if err != nil || !bytes.Equal(magic, []byte(FileMagic)) {
+		tokenizer, err := readLegacyModel(r, decodeBody)
+		if err != nil {
+			return nil, ModelMeta{}, fmt.Errorf("%w: %v", ErrBadMagic, err)
+		}
+		return tokenizer, ModelMeta{}, nil
+	}
+
+	var prefix [6]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, ModelMeta{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	version := binary.BigEndian.Uint16(prefix[4:])
+	if version < minFormatVersion || version > FormatVersion {
+		return nil, ModelMeta{}, &VersionError{Version: version}
+	}
+
+	crc := &crcReader{r: r, crc: crc32.NewIEEE()}
+	decoder := gob.NewDecoder(crc)
+
+	// 2. Decode and check the header
+	var header fileHeader
+	if err := decoder.Decode(&header); err != nil {
+		return nil, ModelMeta{}, fmt.Errorf("%w: header: %v", ErrCorrupt, err)
+	}
+	if header.Kind != kind {
+		return nil, ModelMeta{}, &KindError{Want: kind, Got: header.Kind}
+	}
+
+	// 3. Decode Tokenizer and the model body
+	tokenizer, err := decodeTokenizer(decoder, version)
+	if err != nil {
+		return nil, ModelMeta{}, fmt.Errorf("%w: tokenizer: %v", ErrCorrupt, err)
+	}
+	if err := decodeBody(decoder, header); err != nil {
+		return nil, ModelMeta{}, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	// 4. Verify the checksum
+	var stored uint32
+	if err := binary.Read(r, binary.BigEndian, &stored); err != nil {
+		return nil, ModelMeta{}, fmt.Errorf("%w: missing checksum: %v", ErrCorrupt, err)
+	}
+	if stored != crc.crc.Sum32() {
+		return nil, ModelMeta{}, ErrChecksum
+	}
+
+	return tokenizer, header.Meta, nil
+}
+
+// readLegacyModel reads a file from before the header existed:
+// a bare gob stream of the tokenizer followed by the model body.
+func readLegacyModel(r io.Reader, decodeBody func(*gob.Decoder, fileHeader) error) (*Tokenizer, error) {
+	decoder := gob.NewDecoder(r)
+	tokenizer, err := decodeTokenizer(decoder, 0)
+	if err != nil {
+		return nil, err
+	}
+	if err := decodeBody(decoder, fileHeader{}); err != nil {
+		return nil, err
+	}
+	return tokenizer, nil
+}
+
+// decodeTokenizer decodes a Tokenizer written with the given format version
+// (0 for legacy files), filling in fields older files lack.
+func decodeTokenizer(decoder *gob.Decoder, version uint16) (*Tokenizer, error) {
+	tokenizer := &Tokenizer{}
+	if version < 2 {
+		var flat flatTokenizer
+		if err := decoder.Decode(&flat); err != nil {
+			return nil, err
+		}
+		tokenizer = flat.tokenizer()
+	} else if err := decoder.Decode(tokenizer); err != nil {
+		return nil, err
+	}
+
+	// Gob leaves out empty maps and parts.
+	if tokenizer.Vocabulary == nil {
+		tokenizer.Vocabulary = NewVocabulary()
+	}
+	if tokenizer.TransitionCounts == nil {
+		tokenizer.TransitionCounts = NewTransitionCounts()
+	}
+	if tokenizer.Tokens == nil {
+		tokenizer.Tokens = make(map[string]int)
+	}
+	if tokenizer.UnigramMap == nil {
+		tokenizer.UnigramMap = make(map[int]int)
+	}
+	if tokenizer.UnigramFreq == nil {
+		tokenizer.UnigramFreq = make(map[int]map[int]int)
+	}
+	if len(tokenizer.TokenList) != tokenizer.Count {
+		tokenizer.rebuildTokenList() // Files written before TokenList existed
+	}
+	return tokenizer, nil
+}
+
+// flatTokenizer is the layout of the Tokenizer before format version 2.
+type flatTokenizer struct {
+	Tokens       map[string]int
+	UnigramMap   map[int]int
+	Count        int
+	UnigramFreq  map[int]map[int]int
+	TokenList    []string
+	NGramOrder   int
+	ContextFreq  map[string]map[int]int
+	PreTokenizer string
+	BPE          *BPE
+}
+
+func (f *flatTokenizer) tokenizer() *Tokenizer {
+	return &Tokenizer{
+		Vocabulary: &Vocabulary{
+			Tokens:       f.Tokens,
+			Count:        f.Count,
+			TokenList:    f.TokenList,
+			PreTokenizer: f.PreTokenizer,
+			BPE:          f.BPE,
+		},
+		TransitionCounts: &TransitionCounts{
+			UnigramMap:  f.UnigramMap,
+			UnigramFreq: f.UnigramFreq,
+			NGramOrder:  f.NGramOrder,
+			ContextFreq: f.ContextFreq,
+		},
+	}
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// crcReader checksums everything read through it. It implements
+// io.ByteReader so gob reads exactly the bytes it needs and nothing more.
+type crcReader struct {
+	r   *bufio.Reader
+	crc hash.Hash32
+}
+
+func (c *crcReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.crc.Write(p[:n])
+	return n, err
+}
+
+func (c *crcReader) ReadByte() (byte, error) {
+	b, err := c.r.ReadByte()
+	if err == nil {
+		c.crc.Write([]byte{b})
+	}
+	return b, err
+}
@@ -0,0 +1,225 @@
+package core
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var formatTestTexts = []string{
+	"오늘 날씨가 정말 좋다", "나는 밥을 먹었다", "너는 밥을 굶었다",
+	"오늘 나는 학교에 갔다", "날씨가 좋아서 산책을 했다", "밥을 먹고 잤다",
+}
+
+func writeTestModel(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "model.bin")
+	texts := append([]string(nil), formatTestTexts...)
+	if _, err := CreateAndTrainModel(texts, 0.5, 2, path); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadModelReadsHeader(t *testing.T) {
+	path := writeTestModel(t)
+
+	model, err := LoadModel(path, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Meta.Epochs != 2 || model.Meta.LearningRate != 0.5 || model.Meta.CorpusSize == 0 {
+		t.Errorf("unexpected metadata %+v", model.Meta)
+	}
+}
+
+func TestLoadModelErrors(t *testing.T) {
+	path := writeTestModel(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeVariant := func(name string, mutate func([]byte) []byte) string {
+		variant := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(variant, mutate(append([]byte(nil), data...)), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return variant
+	}
+
+	foreign := writeVariant("foreign", func([]byte) []byte { return []byte("hello, world") })
+	if _, err := LoadModel(foreign, 0.1); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("foreign file: got %v, want ErrBadMagic", err)
+	}
+
+	version := writeVariant("version", func(b []byte) []byte { b[5] = 99; return b })
+	var versionErr *VersionError
+	if _, err := LoadModel(version, 0.1); !errors.As(err, &versionErr) {
+		t.Errorf("future version: got %v, want *VersionError", err)
+	}
+
+	checksum := writeVariant("checksum", func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b })
+	if _, err := LoadModel(checksum, 0.1); !errors.Is(err, ErrChecksum) {
+		t.Errorf("bad checksum: got %v, want ErrChecksum", err)
+	}
+
+	var kindErr *KindError
+	if _, err := LoadEmbeddingModel(path, 0.1); !errors.As(err, &kindErr) {
+		t.Errorf("wrong kind: got %v, want *KindError", err)
+	}
+}
+
+func TestLoadLegacyModel(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("오늘 날씨가 정말 좋다")
+	weights := NewDenseWeights(tokenizer.Count, randomInit)
+
+	path := filepath.Join(t.TempDir(), "legacy.bin")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoder := gob.NewEncoder(file)
+	if err := encoder.Encode(flatTestTokenizer(tokenizer)); err != nil {
+		t.Fatal(err)
+	}
+	if err := encodeWeights(encoder, weights); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	model, err := LoadModel(path, 0.1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if model.Weights.Size() != tokenizer.Count {
+		t.Errorf("loaded %d rows, want %d", model.Weights.Size(), tokenizer.Count)
+	}
+}
+
+// flatTestTokenizer returns tokenizer in the layout written before format version 2.
+func flatTestTokenizer(tokenizer *Tokenizer) flatTokenizer {
+	return flatTokenizer{
+		Tokens:      tokenizer.Tokens,
+		UnigramMap:  tokenizer.UnigramMap,
+		Count:       tokenizer.Count,
+		UnigramFreq: tokenizer.UnigramFreq,
+		TokenList:   tokenizer.TokenList,
+		NGramOrder:  tokenizer.NGramOrder,
+		ContextFreq: tokenizer.ContextFreq,
+	}
+}
+
+func TestLoadVersion1Model(t *testing.T) {
+	tokenizer := NewNGramTokenizer(3)
+	for _, text := range formatTestTexts {
+		tokenizer.AddtoModel(text)
+	}
+	tokenizer.BuildUnigramMap()
+	weights := NewSparseWeights(tokenizer.Count, tokenizer.UnigramFreq, randomInit)
+
+	// A version 1 file stores the tokenizer as one flat struct.
+	var stream bytes.Buffer
+	encoder := gob.NewEncoder(&stream)
+	if err := encoder.Encode(fileHeader{Kind: KindLinear}); err != nil {
+		t.Fatal(err)
+	}
+	if err := encoder.Encode(flatTestTokenizer(tokenizer)); err != nil {
+		t.Fatal(err)
+	}
+	// Before version 3 a negative size marks sparse weights.
+	if err := encoder.Encode(-weights.Size()); err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range weights.Rows {
+		if err := encoder.Encode(sparseRowF16{Cols: row.Cols, Vals: toFloat16(row.Vals)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var file bytes.Buffer
+	file.WriteString(FileMagic)
+	binary.Write(&file, binary.BigEndian, uint16(1))
+	file.Write(stream.Bytes())
+	binary.Write(&file, binary.BigEndian, crc32.ChecksumIEEE(stream.Bytes()))
+
+	model, err := ReadModel(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := model.Stats.(*TransitionCounts)
+	if model.Lexicon.Size() != tokenizer.Count || counts.NGramOrder != 3 || len(counts.ContextFreq) != len(tokenizer.ContextFreq) {
+		t.Errorf("version 1 tokenizer decoded with %d tokens, order %d", model.Lexicon.Size(), counts.NGramOrder)
+	}
+	if _, ok := model.Weights.(*SparseWeights); !ok || model.Weights.Size() != tokenizer.Count {
+		t.Errorf("version 1 weights decoded as %T of size %d", model.Weights, model.Weights.Size())
+	}
+}
+
+func TestEmptySparseWeightsKeepLayout(t *testing.T) {
+	var buf bytes.Buffer
+	tokenizer := NewTokenizer()
+	if _, err := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	model, err := ReadModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := model.Weights.(*SparseWeights); !ok {
+		t.Errorf("empty sparse weights decoded as %T", model.Weights)
+	}
+}
+
+func TestWriteToReadModel(t *testing.T) {
+	tokenizer := NewNGramTokenizer(3)
+	for _, text := range formatTestTexts {
+		tokenizer.AddtoModel(text)
+	}
+	tokenizer.BuildUnigramMap()
+
+	model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.5)
+	model.Train(3, 32)
+
+	var buf bytes.Buffer
+	n, err := model.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+	}
+
+	loaded, err := ReadModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < tokenizer.Count; i++ {
+		want := model.Weights.Scores(i, nil)
+		got := loaded.Weights.Scores(i, nil)
+		for j := range want {
+			if math.Abs(float64(want[j]-got[j])) > 1e-2 {
+				t.Fatalf("weight (%d, %d) = %f, want %f", i, j, got[j], want[j])
+			}
+		}
+	}
+
+	buf.Reset()
+	if _, err := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 3).WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	ngram, err := ReadNGramModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contexts := ngram.Stats.(*TransitionCounts).ContextFreq
+	if ngram.Order != 3 || len(contexts) != len(tokenizer.ContextFreq) {
+		t.Errorf("n-gram model did not round-trip: order %d, %d contexts", ngram.Order, len(contexts))
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"strings"
+)
+
+// DefaultMaxTokens is the number of tokens generated after the prompt when
+// GenerateOptions.MaxTokens is not set.
+const DefaultMaxTokens = 50
+
+// ErrEmptyVocabulary is returned when a model has no tokens to generate from.
+var ErrEmptyVocabulary = errors.New("model vocabulary is empty")
+
+// ErrEmptyText is returned when generation ends without any text, for
+// example when a sentence started from BOTTOKEN ends right away.
+var ErrEmptyText = errors.New("generated text is empty")
+
+// Generator produces a sentence continuing a prompt.
+type Generator interface {
+	Generate(ctx context.Context, prompt string, opts GenerateOptions) (string, error)
+}
+
+// GenerateOptions controls a single Generate call.
+type GenerateOptions struct {
+	// MaxTokens limits the number of generated tokens after the prompt.
+	// 0 means DefaultMaxTokens.
+	MaxTokens int
+	// Rand picks the start token when no word of the prompt is known.
+	// If nil, the global math/rand source is used.
+	Rand *rand.Rand
+}
+
+// Predictor is a next-token model that can be driven by generate. Its
+// token indices are those of GetLexicon, and GetStats holds the counts it
+// was built from.
+type Predictor interface {
+	Predict(currentTokenIndex int, generatedTokens []int) int
+	GetLexicon() Lexicon
+	GetStats() TransitionStats
+}
+
+func (m *LinearModel) GetLexicon() Lexicon       { return m.Lexicon }
+func (m *LinearModel) GetStats() TransitionStats { return m.Stats }
+
+// Generate continues prompt until ENDTOKEN or opts.MaxTokens.
+func (m *LinearModel) Generate(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	return generate(ctx, m, prompt, opts)
+}
+
+func (m *EmbeddingModel) GetLexicon() Lexicon       { return m.Lexicon }
+func (m *EmbeddingModel) GetStats() TransitionStats { return m.Stats }
+
+// Generate continues prompt until ENDTOKEN or opts.MaxTokens.
+func (m *EmbeddingModel) Generate(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	return generate(ctx, m, prompt, opts)
+}
+
+func (m *NGramModel) GetLexicon() Lexicon       { return m.Lexicon }
+func (m *NGramModel) GetStats() TransitionStats { return m.Stats }
+
+// Generate continues prompt until ENDTOKEN or opts.MaxTokens.
+func (m *NGramModel) Generate(ctx context.Context, prompt string, opts GenerateOptions) (string, error) {
+	return generate(ctx, m, prompt, opts)
+}
+
+// generate runs the predict loop shared by every Predictor.
+// Known words of the prompt become the starting context; when none are
+// known, generation starts from BOTTOKEN like a new sentence, or from a
+// random token for lexicons built before BOTTOKEN existed.
+func generate(ctx context.Context, p Predictor, prompt string, opts GenerateOptions) (string, error) {
+	lexicon := p.GetLexicon()
+	if lexicon.Size() == 0 {
+		return "", ErrEmptyVocabulary
+	}
+
+	maxTokens := opts.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = DefaultMaxTokens
+	}
+
+	var generatedIndices []int
+	var words []string
+	for _, word := range lexicon.Tokenize(prompt) {
+		if idx, ok := lexicon.GetTokenIndex(word); ok && !isSpecialToken(word) {
+			generatedIndices = append(generatedIndices, idx)
+			words = append(words, word)
+		}
+	}
+
+	if len(generatedIndices) == 0 {
+		if idx, ok := lexicon.GetTokenIndex(BOTTOKEN); ok {
+			generatedIndices = append(generatedIndices, idx)
+		} else {
+			idx := randomStartToken(lexicon, opts.Rand)
+			generatedIndices = append(generatedIndices, idx)
+			words = append(words, lexicon.GetToken(idx))
+		}
+	}
+
+	// Continue generating the sentence from the last prompt token.
+	currentIndex := generatedIndices[len(generatedIndices)-1]
+	for i := 0; i < maxTokens; i++ {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+
+		predictedIndex := p.Predict(currentIndex, generatedIndices)
+		predictedToken := lexicon.GetToken(predictedIndex)
+		if isSpecialToken(predictedToken) {
+			// Stop at end token. BOTTOKEN and UNKTOKEN are masked, so they
+			// are only predicted when every candidate was.
+			break
+		}
+
+		generatedIndices = append(generatedIndices, predictedIndex)
+		words = append(words, predictedToken)
+		currentIndex = predictedIndex
+	}
+
+	text := lexicon.Detokenize(words)
+	if strings.TrimSpace(text) == "" {
+		return "", ErrEmptyText
+	}
+	return text, nil
+}
+
+// randomStartToken picks a uniformly random token that is not a special token.
+func randomStartToken(lexicon Lexicon, rng *rand.Rand) int {
+	intn := rand.Intn
+	if rng != nil {
+		intn = rng.Intn
+	}
+	for {
+		idx := intn(lexicon.Size())
+		if !isSpecialToken(lexicon.GetToken(idx)) || lexicon.Size() <= 3 {
+			return idx
+		}
+	}
+}
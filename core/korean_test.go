@@ -1,6 +1,7 @@
 package core
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"math/rand"
@@ -100,7 +101,12 @@ func TestMakeData(t *testing.T) {
 		t.Fatal("No sentences extracted from outbox.json")
 	}
 
-	CreateAndTrainModel(sentens, 0.1, 15, "model.bin")
+	// Epochs is an upper bound, early stopping on the validation split picks the count.
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 50
+	if _, err := CreateAndTrainModelWithConfig(sentens, cfg, "model.bin"); err != nil {
+		t.Fatal(err)
+	}
 	fmt.Printf("Model created successfully from %d sentences.", len(sentens))
 }
 
@@ -122,7 +128,12 @@ func TestMakeDatasetData(t *testing.T) {
 		datas = datas[:5000]
 	}
 
-	CreateAndTrainModel(datas, 0.1, 5, "model_x.bin")
+	// Epochs is an upper bound, early stopping on the validation split picks the count.
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 50
+	if _, err := CreateAndTrainModelWithConfig(datas, cfg, "model_x.bin"); err != nil {
+		t.Fatal(err)
+	}
 	fmt.Printf("Model created successfully from %d sentences.", len(datas))
 }
 
@@ -210,7 +221,12 @@ func TestMakeTotalData(t *testing.T) {
 	//	sentens = sentens[:10000]
 	//}
 
-	CreateAndTrainModel(sentens, 0.1, 5, "model.bin")
+	// Epochs is an upper bound, early stopping on the validation split picks the count.
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 50
+	if _, err := CreateAndTrainModelWithConfig(sentens, cfg, "model.bin"); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestLongSentense(t *testing.T) {
@@ -220,7 +236,7 @@ func TestLongSentense(t *testing.T) {
 		t.Fail()
 	}
 
-	pick := func(length int, dict Tokenizer) string {
+	pick := func(length int, dict *Vocabulary) string {
 		rndn := rand.Intn(length)
 		for key := range dict.Tokens {
 			if rndn == 0 {
@@ -231,23 +247,16 @@ func TestLongSentense(t *testing.T) {
 		panic("unreachable!")
 	}
 
-	selects := pick(model.Tokenizer.Count, *model.Tokenizer)
+	selects := pick(model.Lexicon.Size(), model.Lexicon.(*Vocabulary))
 	fmt.Println(selects)
-	data := model.Predict(model.Tokenizer.Tokens[selects], make([]int, 0))
-	fmt.Println(model.Tokenizer.GetToken(data))
 
-	fmt.Printf("Input: %s, Predict: %s\n", selects, model.Tokenizer.GetToken(data))
-
-	var intmake []int
-	for {
-		data = model.Predict(data, intmake)
-		if model.Tokenizer.GetToken(data) == ENDTOKEN {
-			break
-		}
-		intmake = append(intmake, data)
-		fmt.Printf("%s ", model.Tokenizer.GetToken(data))
+	var generator Generator = model
+	sentence, err := generator.Generate(context.Background(), selects, GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
 	}
 
+	fmt.Printf("Input: %s, Generated: %s\n", selects, sentence)
 }
 
 // KommonGenItem defines the structure for an item in the kommongen_train.json file,
@@ -308,6 +317,11 @@ func TestMakeKommongenData(t *testing.T) {
 	if len(sentens) > 5000 {
 		sentens = sentens[:5000]
 	}
-	CreateAndTrainModel(sentens, 0.1, 5, "kommongen_model.bin")
+	// Epochs is an upper bound, early stopping on the validation split picks the count.
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 50
+	if _, err := CreateAndTrainModelWithConfig(sentens, cfg, "kommongen_model.bin"); err != nil {
+		t.Fatal(err)
+	}
 	fmt.Printf("Model created successfully from %d sentences.", len(sentens))
 }
@@ -5,35 +5,66 @@ import (
 	"math"
 	"math/rand"
 	"runtime"
+	"sync"
 	"time"
 )
 
+// TrainObjective selects what each row of the model is trained toward.
+type TrainObjective int
+
+const (
+	// ObjectiveArgmax trains each token toward its single most frequent
+	// successor, the lowest index on ties.
+	ObjectiveArgmax TrainObjective = iota
+	// ObjectiveDistribution trains each token toward the empirical successor
+	// distribution (soft-target cross-entropy).
+	ObjectiveDistribution
+)
+
 // LinearModel represents a simple linear model for predicting the next token.
+// It is trained on the successor counts in Stats of the tokens of Lexicon.
 type LinearModel struct {
-	Weights      [][]float32
+	Weights      WeightMatrix
 	LearningRate float32
-	Tokenizer    *Tokenizer
+	Lexicon      Lexicon
+	Stats        TransitionStats
+	Sampling     *SamplingConfig // nil means greedy decoding
+	Objective    TrainObjective
+	Meta         ModelMeta // How the model was created, stored in the file header
 }
 
-// NewLinearModel creates and initializes a new LinearModel.
-func NewLinearModel(tokenizer *Tokenizer, learningRate float32) *LinearModel {
+// NewLinearModel creates and initializes a new LinearModel with dense weights.
+func NewLinearModel(lexicon Lexicon, stats TransitionStats, learningRate float32) *LinearModel {
 	rand.Seed(time.Now().UnixNano())
-	vocabSize := tokenizer.Count
-	weights := make([][]float32, vocabSize)
-	for i := range weights {
-		weights[i] = make([]float32, vocabSize)
-		for j := range weights[i] {
-			weights[i][j] = rand.Float32() - 0.5 // Initialize with small random values
-		}
+	weights := NewDenseWeights(lexicon.Size(), randomInit) // Initialize with small random values
+
+	return &LinearModel{
+		Weights:      weights,
+		LearningRate: learningRate,
+		Lexicon:      lexicon,
+		Stats:        stats,
 	}
+}
+
+// NewSparseLinearModel creates a LinearModel that only stores weights for
+// successors observed in stats, so memory grows with the number of distinct
+// transitions instead of the vocabulary squared.
+func NewSparseLinearModel(lexicon Lexicon, stats TransitionStats, learningRate float32) *LinearModel {
+	rand.Seed(time.Now().UnixNano())
+	weights := NewSparseWeights(lexicon.Size(), successorCounts(stats, lexicon.Size()), randomInit)
 
 	return &LinearModel{
 		Weights:      weights,
 		LearningRate: learningRate,
-		Tokenizer:    tokenizer,
+		Lexicon:      lexicon,
+		Stats:        stats,
 	}
 }
 
+func randomInit() float32 {
+	return rand.Float32() - 0.5
+}
+
 // softmax applies the softmax function to a slice of float32.
 func softmax(input []float32) []float32 {
 	if len(input) == 0 {
@@ -60,88 +91,206 @@ func softmax(input []float32) []float32 {
 }
 
 // Predict predicts the next token index given the current token index.
+// The token is chosen according to m.Sampling, whose penalties are computed
+// from generatedTokens.
 func (m *LinearModel) Predict(currentTokenIndex int, generatedTokens []int) int {
-	if currentTokenIndex < 0 || currentTokenIndex >= len(m.Weights) {
-		return rand.Intn(m.Tokenizer.Count) // Out of bounds safety
+	vocabSize := m.Lexicon.Size()
+	if currentTokenIndex < 0 || currentTokenIndex >= vocabSize {
+		return m.Sampling.intn(vocabSize) // Out of bounds safety
 	}
 
-	scores := m.Weights[currentTokenIndex]
-	probabilities := softmax(scores)
-
-	maxProb := float32(-1.0)
-	predictedIndex := 0
-	for i, p := range probabilities {
-		if p > maxProb {
-			maxProb = p
-			predictedIndex = i
-		}
+	// Scores returns a copy, so sampling never touches the weights.
+	var scores []float32
+	if currentTokenIndex < m.Weights.Size() {
+		scores = m.Weights.Scores(currentTokenIndex, nil)
+	} else {
+		// Added to the lexicon since the weights were sized, see GrowVocabulary
+		scores = countScores(m.Stats.Successors(currentTokenIndex), vocabSize)
 	}
-	return predictedIndex
+	maskSpecial(m.Lexicon, scores)
+
+	return m.Sampling.Sample(scores, withCurrent(currentTokenIndex, generatedTokens))
+}
+
+// Train trains the model using mini-batch gradient descent with the model's
+// LearningRate and Objective, on all CPU cores.
+func (m *LinearModel) Train(epochs int, batchSize int) TrainHistory {
+	// Without a checkpoint path training can only fail by diverging, which
+	// shows in the losses of the last epoch.
+	history, _ := m.TrainWithConfig(TrainConfig{
+		LearningRate: m.LearningRate,
+		Epochs:       epochs,
+		BatchSize:    batchSize,
+		Objective:    m.Objective,
+	}, nil)
+	return history
 }
 
-// Train trains the model using mini-batch gradient descent.
-func (m *LinearModel) Train(epochs int, batchSize int) {
-	vocabSize := m.Tokenizer.Count
+// TrainWithConfig trains the model using mini-batch gradient descent.
+// The model's LearningRate and Objective are set from cfg, and the weights
+// are updated by cfg.Optimizer at the rate given by cfg.Schedule. When
+// validation is not empty, it is evaluated after every epoch. The statistics
+// of each epoch are passed to cfg.OnEpoch and returned as the history, and training
+// stops early, restores the best weights or writes checkpoints as cfg asks.
+// The returned error is a failure to write a checkpoint, or ErrDiverged
+// when a loss became NaN or infinite; the best weights, if cfg.RestoreBest
+// kept any, are restored before ErrDiverged is returned.
+func (m *LinearModel) TrainWithConfig(cfg TrainConfig, validation Transitions) (TrainHistory, error) {
+	return m.train(cfg, validation, newTrainState(cfg))
+}
+
+// train runs the epochs from state.NextEpoch to cfg.Epochs.
+// Every row of the model only depends on its own token, so each row in a
+// batch is updated as soon as its gradient is known.
+func (m *LinearModel) train(cfg TrainConfig, validation Transitions, state *trainState) (TrainHistory, error) {
+	m.LearningRate = cfg.LearningRate
+	m.Objective = cfg.Objective
+	batchSize := cfg.BatchSize
+
+	vocabSize := m.Lexicon.Size()
 	if vocabSize == 0 {
-		return // Cannot train on an empty vocabulary
+		return state.History, nil // Cannot train on an empty vocabulary
 	}
 
-	// Create a slice of token indices to shuffle for mini-batch
-	tokenIndices := make([]int, 0, len(m.Tokenizer.UnigramMap))
-	for k := range m.Tokenizer.UnigramMap {
-		tokenIndices = append(tokenIndices, k)
-	}
+	// Create a slice of token indices to shuffle for mini-batch,
+	// in order so the shuffle only depends on the seed
+	tokenIndices := trainingRows(m.Stats, vocabSize)
+
+	optimizer := state.Optimizer
+	optimizer.Resize(vocabSize)
+	schedule := cfg.schedule()
 
-	for epoch := 0; epoch < epochs; epoch++ {
+	workers := cfg.workers()
+	grads := make([][]float32, workers)
+	losses := make([]float32, len(tokenIndices))
+	for epoch := state.NextEpoch; epoch < cfg.Epochs && !state.History.StoppedEarly; epoch++ {
+		rate := schedule.Rate(cfg.LearningRate, epoch, cfg.Epochs)
 		runtime.GC()
 		fmt.Printf("Epoch: %d ", epoch)
 
 		// Shuffle the training data for each epoch
-		rand.Shuffle(len(tokenIndices), func(i, j int) {
+		rng := state.epochRand(epoch)
+		rng.Shuffle(len(tokenIndices), func(i, j int) {
 			tokenIndices[i], tokenIndices[j] = tokenIndices[j], tokenIndices[i]
 		})
 
-		// Process data in mini-batches
+		// Process data in mini-batches. Every row only touches its own
+		// weights and optimizer state, so the rows of a batch are split
+		// across workers without changing the result.
 		for i := 0; i < len(tokenIndices); i += batchSize {
 			end := i + batchSize
 			if end > len(tokenIndices) {
 				end = len(tokenIndices)
 			}
-			batch := tokenIndices[i:end]
 
-			// Accumulate gradients for the mini-batch
-			gradients := make([][]float32, vocabSize)
-			for i := range gradients {
-				gradients[i] = make([]float32, vocabSize)
+			var wg sync.WaitGroup
+			for w := 0; w < workers; w++ {
+				start, stop := i+(end-i)*w/workers, i+(end-i)*(w+1)/workers
+				if start == stop {
+					continue
+				}
+				wg.Add(1)
+				go func(w, start, stop int) {
+					defer wg.Done()
+					for k := start; k < stop; k++ {
+						currentTokenIndex := tokenIndices[k]
+						grads[w], losses[k] = m.Weights.Backward(currentTokenIndex, trainingTarget(m.Stats, m.Objective, currentTokenIndex), grads[w])
+						optimizer.Step(currentTokenIndex, m.Weights.Params(currentTokenIndex), grads[w], rate)
+					}
+				}(w, start, stop)
 			}
+			wg.Wait()
+		}
 
-			for _, currentTokenIndex := range batch {
-				nextTokenIndex := m.Tokenizer.UnigramMap[currentTokenIndex]
-
-				scores := m.Weights[currentTokenIndex]
-				probabilities := softmax(scores)
+		// Sum the losses in row order so the total does not depend on scheduling.
+		totalLoss := 0.0
+		for _, loss := range losses {
+			totalLoss += float64(loss)
+		}
 
-				// Calculate gradient for the scores (y_pred - y_true)
-				dScores := make([]float32, vocabSize)
-				copy(dScores, probabilities)
-				dScores[nextTokenIndex] -= 1.0
+		stats := EpochStats{Epoch: epoch, LearningRate: rate}
+		if len(tokenIndices) > 0 {
+			stats.TrainLoss = float32(totalLoss / float64(len(tokenIndices)))
+		}
+		if len(validation) > 0 {
+			stats.Validation = m.Evaluate(validation)
+		}
+		state.History.Epochs = append(state.History.Epochs, stats)
+		state.NextEpoch = epoch + 1
+		printEpochStats(stats, len(validation) > 0)
+		if cfg.OnEpoch != nil {
+			cfg.OnEpoch(stats)
+		}
+		if err := checkDiverged(stats, len(validation) > 0); err != nil {
+			if state.bestWeights != nil {
+				m.Weights = state.bestWeights
+			}
+			return state.History, err
+		}
 
-				// Add to gradients for the current input token's weights
-				for j := 0; j < vocabSize; j++ {
-					gradients[currentTokenIndex][j] += dScores[j]
-				}
+		stop := false
+		if len(validation) > 0 {
+			if state.Stopping.observe(epoch, stats.Validation.Loss) && cfg.RestoreBest {
+				state.bestWeights = m.Weights.Clone()
 			}
+			state.History.BestEpoch = state.Stopping.BestEpoch
+			stop = state.Stopping.stop()
+		}
 
-			// Update weights using the accumulated gradients for the mini-batch
-			for j := 0; j < vocabSize; j++ {
-				for k := 0; k < vocabSize; k++ {
-					if gradients[j][k] != 0 {
-						update := m.LearningRate * gradients[j][k]
-						m.Weights[j][k] -= update
-					}
-				}
+		if stop {
+			fmt.Printf("Stopping early, no improvement since epoch %d.\n", state.Stopping.BestEpoch)
+			state.History.StoppedEarly = true
+		}
+
+		if cfg.CheckpointPath != "" && (stop || state.NextEpoch == cfg.Epochs || state.NextEpoch%cfg.checkpointEvery() == 0) {
+			if err := m.writeCheckpoint(cfg.CheckpointPath, state); err != nil {
+				return state.History, fmt.Errorf("writing checkpoint: %w", err)
 			}
 		}
-		fmt.Println("Done.")
+
+		if stop {
+			break
+		}
+	}
+
+	if state.bestWeights != nil {
+		m.Weights = state.bestWeights
+	}
+	return state.History, nil
+}
+
+// Evaluate returns the loss, perplexity and accuracy of the model on data.
+func (m *LinearModel) Evaluate(data Transitions) Evaluation {
+	return evaluate(m.Weights.Scores, m.Weights.Size(), data)
+}
+
+// trainingRows returns the indices, in order, of the first vocabSize tokens
+// that have successors in stats and thus a training target.
+func trainingRows(stats TransitionStats, vocabSize int) []int {
+	var tokenIndices []int
+	for idx := 0; idx < vocabSize; idx++ {
+		if len(stats.Successors(idx)) > 0 {
+			tokenIndices = append(tokenIndices, idx)
+		}
+	}
+	return tokenIndices
+}
+
+// trainingTarget returns the distribution the successors of tokenIndex are trained toward.
+func trainingTarget(stats TransitionStats, objective TrainObjective, tokenIndex int) map[int]float32 {
+	freqMap := stats.Successors(tokenIndex)
+	if objective != ObjectiveDistribution {
+		return map[int]float32{mostFrequent(freqMap): 1.0}
+	}
+
+	// Soft target: the empirical successor distribution.
+	total := 0
+	for _, freq := range freqMap {
+		total += freq
+	}
+	target := make(map[int]float32, len(freqMap))
+	for nextID, freq := range freqMap {
+		target[nextID] = float32(freq) / float32(total)
 	}
+	return target
 }
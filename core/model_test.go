@@ -0,0 +1,263 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestTrainDistribution(t *testing.T) {
+	tokenizer := NewTokenizer()
+	for i := 0; i < 3; i++ {
+		tokenizer.AddtoModel("나는 밥을 먹었다")
+	}
+	tokenizer.AddtoModel("나는 학교에 갔다")
+	tokenizer.BuildUnigramMap()
+
+	for name, model := range map[string]*LinearModel{
+		"dense":  NewLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0),
+		"sparse": NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0),
+	} {
+		model.Objective = ObjectiveDistribution
+		model.Train(300, 32)
+
+		from, _ := tokenizer.GetTokenIndex("나는")
+		probabilities := softmax(model.Weights.Scores(from, nil))
+		rice, _ := tokenizer.GetTokenIndex("밥을")
+		school, _ := tokenizer.GetTokenIndex("학교에")
+
+		if math.Abs(float64(probabilities[rice])-0.75) > 0.05 {
+			t.Errorf("%s: P(밥을|나는) = %f, want about 0.75", name, probabilities[rice])
+		}
+		if math.Abs(float64(probabilities[school])-0.25) > 0.05 {
+			t.Errorf("%s: P(학교에|나는) = %f, want about 0.25", name, probabilities[school])
+		}
+	}
+}
+
+func TestSparseBackwardMatchesDense(t *testing.T) {
+	freq := map[int]map[int]int{0: {1: 3, 2: 1}}
+	sparse := NewSparseWeights(5, freq, func() float32 { return 0.25 })
+	dense := make(DenseWeights, 5)
+	for i := range dense {
+		dense[i] = sparse.Scores(i, nil)
+	}
+
+	target := map[int]float32{1: 0.75, 2: 0.25}
+	_, denseLoss := dense.Backward(0, target, nil)
+	_, sparseLoss := sparse.Backward(0, target, nil)
+
+	if math.Abs(float64(denseLoss-sparseLoss)) > 1e-5 {
+		t.Errorf("sparse loss %f, dense loss %f", sparseLoss, denseLoss)
+	}
+}
+
+func TestEmbeddingModelLearnsChain(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("오늘 날씨가 정말 좋다")
+	tokenizer.BuildUnigramMap()
+
+	model := NewEmbeddingModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 8, 0.5)
+	model.Train(200, 32)
+
+	from, _ := tokenizer.GetTokenIndex("날씨가")
+	if got := tokenizer.GetToken(model.Predict(from, nil)); got != "정말" {
+		t.Errorf("Predict after 날씨가 = %q, want 정말", got)
+	}
+}
+
+func TestEmbeddingModelReportsValidation(t *testing.T) {
+	tokenizer := NewTokenizer()
+	for _, text := range formatTestTexts {
+		tokenizer.AddtoModel(text)
+	}
+	validation := CountTransitions(tokenizer, formatTestTexts[:2])
+
+	model := NewEmbeddingModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 8, 0.5)
+	cfg := DefaultTrainConfig()
+	cfg.LearningRate = 0.5
+	cfg.Epochs = 20
+	cfg.Patience = 0
+	cfg.Seed = 1
+	history, err := model.TrainWithConfig(cfg, validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history.Epochs) != 20 {
+		t.Fatalf("got %d epochs, want 20", len(history.Epochs))
+	}
+	first, last := history.Epochs[0], history.Epochs[19]
+	if last.Validation.Loss >= first.Validation.Loss {
+		t.Errorf("validation loss did not decrease: %f -> %f", first.Validation.Loss, last.Validation.Loss)
+	}
+}
+
+func TestGenerateStopsAtEndToken(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("오늘 날씨가 정말 좋다")
+	tokenizer.BuildUnigramMap()
+
+	model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+	model.Train(50, 32)
+
+	var generator Generator = model
+	got, err := generator.Generate(context.Background(), "날씨가", GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "날씨가 정말 좋다" {
+		t.Errorf("Generate = %q, want %q", got, "날씨가 정말 좋다")
+	}
+}
+
+func TestLearnGrowsVocabulary(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		tokenizer := NewTokenizer()
+		tokenizer.AddtoModel("나는 밥을 먹었다")
+		tokenizer.BuildUnigramMap()
+
+		model := NewLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+		if sparse {
+			model = NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+		}
+		model.Objective = ObjectiveDistribution
+		model.Train(50, 32)
+
+		if _, err := model.Learn([]string{"나는 커피를 마셨다"}, 100); err != nil {
+			t.Fatal(err)
+		}
+
+		if model.Weights.Size() != tokenizer.Count {
+			t.Fatalf("sparse=%v: weights cover %d tokens, tokenizer has %d", sparse, model.Weights.Size(), tokenizer.Count)
+		}
+		from, _ := tokenizer.GetTokenIndex("커피를")
+		if got := tokenizer.GetToken(model.Predict(from, nil)); got != "마셨다" {
+			t.Errorf("sparse=%v: Predict after 커피를 = %q, want 마셨다", sparse, got)
+		}
+		rice, _ := tokenizer.GetTokenIndex("밥을")
+		coffee, _ := tokenizer.GetTokenIndex("커피를")
+		from, _ = tokenizer.GetTokenIndex("나는")
+		if probabilities := softmax(model.Weights.Scores(from, nil)); math.Abs(float64(probabilities[rice]-probabilities[coffee])) > 0.05 {
+			t.Errorf("sparse=%v: P(밥을|나는) = %f, P(커피를|나는) = %f, want them equal", sparse, probabilities[rice], probabilities[coffee])
+		}
+	}
+}
+
+func TestLearnKeepsPrunedVocabulary(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("나는 빵을 먹었다")
+	tokenizer.Prune(2, 0)
+
+	model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+	model.Objective = ObjectiveDistribution
+	count := tokenizer.Count
+	if _, err := model.Learn([]string{"나는 떡을 먹었다", "너는 떡을 먹었다"}, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokenizer.Count != count {
+		t.Errorf("vocabulary grew from %d to %d tokens: %v", count, tokenizer.Count, tokenizer.TokenList)
+	}
+	from, _ := tokenizer.GetTokenIndex("나는")
+	unk, _ := tokenizer.GetTokenIndex(UNKTOKEN)
+	if got := tokenizer.UnigramFreq[from][unk]; got != 2 {
+		t.Errorf("count of 나는 -> UNK = %d, want 2", got)
+	}
+}
+
+func TestGrowVocabulary(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		tokenizer := NewTokenizer()
+		tokenizer.AddtoModel("나는 밥을 먹었다")
+		tokenizer.BuildUnigramMap()
+
+		model := NewLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+		if sparse {
+			model = NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+		}
+		model.Objective = ObjectiveDistribution
+		model.Train(50, 32)
+
+		tokenizer.AddtoModel("오늘 커피를 마셨다")
+		tokenizer.AddtoModel("오늘 커피를 마셨다")
+		tokenizer.AddtoModel("오늘 커피를 쏟았다")
+		from, _ := tokenizer.GetTokenIndex("커피를")
+
+		// Before growing, new tokens are predicted from their counts.
+		if got := tokenizer.GetToken(model.Predict(from, nil)); got != "마셨다" {
+			t.Errorf("sparse=%v: Predict after 커피를 before growing = %q, want 마셨다", sparse, got)
+		}
+
+		model.GrowVocabulary()
+		if model.Weights.Size() != tokenizer.Count {
+			t.Fatalf("sparse=%v: weights cover %d tokens, tokenizer has %d", sparse, model.Weights.Size(), tokenizer.Count)
+		}
+		if got := tokenizer.GetToken(model.Predict(from, nil)); got != "마셨다" {
+			t.Errorf("sparse=%v: Predict after 커피를 = %q, want 마셨다", sparse, got)
+		}
+		start, _ := tokenizer.GetTokenIndex("나는")
+		if got := tokenizer.GetToken(model.Predict(start, nil)); got != "밥을" {
+			t.Errorf("sparse=%v: Predict after 나는 = %q, want 밥을", sparse, got)
+		}
+	}
+}
+
+func TestGenerateStartsSentenceWithoutPrompt(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("오늘 날씨가 좋다")
+	tokenizer.AddtoModel("오늘 밥을 먹었다")
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.BuildUnigramMap()
+
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 2)
+	text, err := model.Generate(context.Background(), "", GenerateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(text, "오늘 ") || strings.Contains(text, BOTTOKEN) {
+		t.Errorf("Generate without prompt = %q, want a sentence opened by 오늘", text)
+	}
+}
+
+func TestGenerateReportsEmptyText(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("안녕")
+	// Most texts are empty, so a new sentence ends right away.
+	tokenizer.AddToken(BOTTOKEN, ENDTOKEN)
+	tokenizer.AddToken(BOTTOKEN, ENDTOKEN)
+
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 2)
+	if text, err := model.Generate(context.Background(), "", GenerateOptions{}); !errors.Is(err, ErrEmptyText) {
+		t.Errorf("Generate = %q, %v; want ErrEmptyText", text, err)
+	}
+}
+
+func TestModelsTakeAnyLexiconAndStats(t *testing.T) {
+	vocab := NewVocabulary()
+	bot, coffee, end := vocab.addWord(BOTTOKEN), vocab.addWord("커피"), vocab.addWord(ENDTOKEN)
+	stats := Transitions{bot: {coffee: 3}, coffee: {end: 3}}
+
+	model := NewSparseLinearModel(vocab, stats, 1.0)
+	model.Objective = ObjectiveDistribution
+	model.Train(20, 4)
+	if got, err := model.Generate(context.Background(), "", GenerateOptions{}); err != nil || got != "커피" {
+		t.Errorf("Generate = %q, %v; want 커피", got, err)
+	}
+	if got, err := NewNGramModel(vocab, stats, 3).Generate(context.Background(), "", GenerateOptions{}); err != nil || got != "커피" {
+		t.Errorf("n-gram Generate = %q, %v; want 커피", got, err)
+	}
+
+	// Only a Tokenizer can be saved or count new texts.
+	if _, err := model.WriteTo(io.Discard); !errors.Is(err, ErrUnsupportedTokenizer) {
+		t.Errorf("WriteTo error %v, want ErrUnsupportedTokenizer", err)
+	}
+	if _, err := model.Learn([]string{"커피"}, 1); !errors.Is(err, ErrUnsupportedTokenizer) {
+		t.Errorf("Learn error %v, want ErrUnsupportedTokenizer", err)
+	}
+}
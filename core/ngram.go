@@ -0,0 +1,104 @@
+package core
+
+import "math"
+
+// NGramModel predicts the next token from the last Order-1 tokens using the
+// successor counts of their contexts in Stats, such as those gathered by
+// Tokenizer.AddtoModel. Orders are interpolated with Witten-Bell smoothing,
+// so an unseen context backs off to shorter ones and finally to the unigram
+// distribution.
+type NGramModel struct {
+	Lexicon  Lexicon
+	Stats    TransitionStats
+	Order    int
+	Sampling *SamplingConfig // nil means greedy decoding
+
+	unigram []float32 // Add-one smoothed P(w), rebuilt when the vocabulary grows
+}
+
+// NewNGramModel creates an NGramModel of the given order over the tokens of
+// lexicon and the counts in stats. Contexts stats did not count, like those
+// longer than Tokenizer.NGramOrder-1, are never used. Texts counted later,
+// for example by LinearModel.Learn, are used as well.
+func NewNGramModel(lexicon Lexicon, stats TransitionStats, order int) *NGramModel {
+	m := &NGramModel{
+		Lexicon: lexicon,
+		Stats:   stats,
+		Order:   order,
+	}
+	m.buildUnigram()
+	return m
+}
+
+// buildUnigram derives P(w) from how often each token appears as a successor.
+func (m *NGramModel) buildUnigram() {
+	vocabSize := m.Lexicon.Size()
+	counts := make([]float32, vocabSize)
+	total := float32(vocabSize)
+	for idx := 0; idx < vocabSize; idx++ {
+		for nextID, freq := range m.Stats.Successors(idx) {
+			if nextID < vocabSize {
+				counts[nextID] += float32(freq)
+				total += float32(freq)
+			}
+		}
+	}
+
+	m.unigram = make([]float32, vocabSize)
+	for i, c := range counts {
+		m.unigram[i] = (c + 1) / total
+	}
+}
+
+// probabilities returns the interpolated distribution of the next token
+// given the history, which ends with the current token.
+func (m *NGramModel) probabilities(history []int) []float32 {
+	if len(m.unigram) != m.Lexicon.Size() {
+		m.buildUnigram() // The lexicon grew since the distribution was built
+	}
+	probabilities := make([]float32, len(m.unigram))
+	copy(probabilities, m.unigram)
+
+	for n := 1; n < m.Order && n <= len(history); n++ {
+		freqMap := m.Stats.ContextSuccessors(history[len(history)-n:])
+		if len(freqMap) == 0 {
+			break // Unseen context, keep the lower order estimate
+		}
+
+		total := 0
+		for _, freq := range freqMap {
+			total += freq
+		}
+
+		// Witten-Bell: lambda = c(h) / (c(h) + T(h)), where T is the number of
+		// distinct successors, so lambda * c(h, w) / c(h) = c(h, w) / (c(h) + T(h)).
+		denominator := float32(total + len(freqMap))
+		lambda := float32(total) / denominator
+		for i := range probabilities {
+			probabilities[i] *= 1 - lambda
+		}
+		for nextID, freq := range freqMap {
+			probabilities[nextID] += float32(freq) / denominator
+		}
+	}
+	return probabilities
+}
+
+// Predict predicts the next token index given the current token and the
+// tokens generated before it.
+func (m *NGramModel) Predict(currentTokenIndex int, generatedTokens []int) int {
+	if currentTokenIndex < 0 || currentTokenIndex >= m.Lexicon.Size() {
+		return m.Sampling.intn(m.Lexicon.Size()) // Out of bounds safety
+	}
+
+	history := withCurrent(currentTokenIndex, generatedTokens)
+	probabilities := m.probabilities(history)
+
+	// Log probabilities act as scores for sampling.
+	scores := make([]float32, len(probabilities))
+	for i, p := range probabilities {
+		scores[i] = float32(math.Log(float64(p)))
+	}
+	maskSpecial(m.Lexicon, scores)
+	return m.Sampling.Sample(scores, history)
+}
@@ -0,0 +1,48 @@
+package core
+
+import "testing"
+
+func TestNGramUsesLongerContext(t *testing.T) {
+	tokenizer := NewNGramTokenizer(3)
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("너는 밥을 굶었다")
+	tokenizer.AddtoModel("너는 밥을 굶었다")
+
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 3)
+	i, _ := tokenizer.GetTokenIndex("나는")
+	rice, _ := tokenizer.GetTokenIndex("밥을")
+
+	// A bigram model would pick 굶었다, the trigram context picks 먹었다.
+	if got := tokenizer.GetToken(model.Predict(rice, []int{i, rice})); got != "먹었다" {
+		t.Errorf("Predict after 나는 밥을 = %q, want 먹었다", got)
+	}
+}
+
+func TestNGramBacksOffOnUnseenContext(t *testing.T) {
+	tokenizer := NewNGramTokenizer(3)
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	tokenizer.AddtoModel("너는 밥을 굶었다")
+	tokenizer.AddtoModel("너는 밥을 굶었다")
+
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 3)
+	rice, _ := tokenizer.GetTokenIndex("밥을")
+	end, _ := tokenizer.GetTokenIndex(ENDTOKEN)
+
+	// The context (ENDTOKEN, 밥을) was never seen, so the bigram counts decide.
+	if got := tokenizer.GetToken(model.Predict(rice, []int{end, rice})); got != "굶었다" {
+		t.Errorf("Predict after unseen context = %q, want 굶었다", got)
+	}
+}
+
+func TestNGramFollowsGrowingTokenizer(t *testing.T) {
+	tokenizer := NewNGramTokenizer(3)
+	tokenizer.AddtoModel("나는 밥을 먹었다")
+	model := NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 3)
+
+	// Tokens added after the model was created, as LinearModel.Learn does.
+	tokenizer.AddtoModel("나는 커피를 마셨다")
+	coffee, _ := tokenizer.GetTokenIndex("커피를")
+	if got := tokenizer.GetToken(model.Predict(coffee, nil)); got != "마셨다" {
+		t.Errorf("Predict after 커피를 = %q, want 마셨다", got)
+	}
+}
@@ -0,0 +1,258 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+	"golang.org/x/text/width"
+)
+
+// NormalizationForm selects the Unicode normalization of a Normalizer.
+type NormalizationForm int
+
+const (
+	NoNormalization NormalizationForm = iota
+	NFC                               // Canonical composition, e.g. joins decomposed Hangul jamo
+	NFKC                              // Compatibility composition, also folds ligatures and circled digits
+)
+
+// Normalizer cleans text before it is split into tokens, so the tokenizer
+// and the Extractor see the same words. The zero value leaves text unchanged.
+type Normalizer struct {
+	Form NormalizationForm
+	// FoldWidth maps full-width ASCII and half-width Hangul to their usual
+	// width. NFKC already folds both, turning half-width Hangul into
+	// conjoining jamo, and comes first, so FoldWidth only matters with
+	// another Form.
+	FoldWidth bool
+	Lowercase bool
+	// SplitPunctuation surrounds punctuation with spaces so "안녕!" becomes
+	// "안녕 !". URLs and the separators of numbers like 3.5 or 1,000 are
+	// kept whole.
+	SplitPunctuation   bool
+	SplitEmoji         bool // Surround emoji, kept whole with their modifiers, with spaces
+	CollapseWhitespace bool // Trim and reduce every run of whitespace to one space
+}
+
+// DefaultNormalizer returns the normalizer used by DefaultTrainConfig, with
+// every step enabled except FoldWidth, which NFKC makes redundant.
+func DefaultNormalizer() Normalizer {
+	return Normalizer{
+		Form:               NFKC,
+		Lowercase:          true,
+		SplitPunctuation:   true,
+		SplitEmoji:         true,
+		CollapseWhitespace: true,
+	}
+}
+
+// Normalize applies the enabled steps to text in the order of the fields.
+func (n Normalizer) Normalize(text string) string {
+	switch n.Form {
+	case NFC:
+		text = norm.NFC.String(text)
+	case NFKC:
+		text = norm.NFKC.String(text)
+	}
+	if n.FoldWidth {
+		text = width.Fold.String(text)
+	}
+	if n.Lowercase {
+		text = strings.ToLower(text)
+	}
+	if n.SplitPunctuation || n.SplitEmoji {
+		text = n.split(text)
+	}
+	if n.CollapseWhitespace {
+		text = strings.Join(strings.Fields(text), " ")
+	}
+	return text
+}
+
+// split surrounds punctuation and emoji with spaces, as enabled.
+func (n Normalizer) split(text string) string {
+	var sb strings.Builder
+	var prev rune
+	inEmoji, regional, splitPrev := false, 0, false
+	for i := 0; i < len(text); {
+		if n.SplitPunctuation && (i == 0 || unicode.IsSpace(prev) || splitPrev) {
+			if length := urlLength(text[i:]); length > 0 {
+				if inEmoji {
+					sb.WriteByte(' ')
+				}
+				sb.WriteString(text[i : i+length])
+				prev, _ = utf8.DecodeLastRuneInString(text[i : i+length])
+				inEmoji, splitPrev = false, false
+				i += length
+				continue
+			}
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		next, _ := utf8.DecodeRuneInString(text[i+size:])
+		i += size
+		splitPrev = false
+		switch {
+		case inEmoji && continuesEmoji(prev, r, regional):
+			sb.WriteRune(r)
+		case n.SplitEmoji && isEmoji(r, next):
+			sb.WriteByte(' ')
+			sb.WriteRune(r)
+			inEmoji, regional = true, 0
+		case n.SplitPunctuation && splitsOff(prev, r, next):
+			sb.WriteByte(' ')
+			sb.WriteRune(r)
+			sb.WriteByte(' ')
+			inEmoji, splitPrev = false, true
+		default:
+			if inEmoji {
+				sb.WriteByte(' ')
+			}
+			sb.WriteRune(r)
+			inEmoji = false
+		}
+		if isRegionalIndicator(r) {
+			regional++
+		}
+		prev = r
+	}
+	return sb.String()
+}
+
+// urlPrefixes start the URLs kept whole by SplitPunctuation.
+var urlPrefixes = []string{"http://", "https://", "www."}
+
+// urlLength returns the length of the URL text starts with, or 0. The URL
+// runs to the next space, without the punctuation after it, like the period
+// ending a sentence or a closing bracket.
+func urlLength(text string) int {
+	for _, prefix := range urlPrefixes {
+		if len(text) < len(prefix) || !strings.EqualFold(text[:len(prefix)], prefix) {
+			continue
+		}
+		end := strings.IndexFunc(text, unicode.IsSpace)
+		if end < 0 {
+			end = len(text)
+		}
+		url := strings.TrimRightFunc(text[:end], func(r rune) bool {
+			return r != '/' && unicode.IsPunct(r)
+		})
+		if len(url) > len(prefix) {
+			return len(url)
+		}
+	}
+	return 0
+}
+
+// separatesDigits reports whether r is the decimal or thousands separator
+// of a number, between the digits prev and next.
+func separatesDigits(prev, r, next rune) bool {
+	return (r == '.' || r == ',') && unicode.IsDigit(prev) && unicode.IsDigit(next)
+}
+
+// splitsOff reports whether r, between prev and next, is punctuation split
+// from the word it is in. Marks that belong inside words, like the # of
+// hashtags, an apostrophe between letters or the separators of a number,
+// stay attached.
+func splitsOff(prev, r, next rune) bool {
+	switch {
+	case r == '\'':
+		return !unicode.IsLetter(prev) || !unicode.IsLetter(next)
+	case separatesDigits(prev, r, next):
+		return false
+	}
+	return unicode.IsPunct(r) && !strings.ContainsRune("#@_-", r)
+}
+
+// isEmoji reports whether r, followed by next, starts an emoji: a flag, a
+// pictograph shown as an emoji by default, or a pictograph usually shown as
+// text, like ♥ or ©, followed by the emoji variation selector. Other
+// symbols, like ° or box drawing, are not emoji.
+func isEmoji(r, next rune) bool {
+	switch {
+	case isRegionalIndicator(r):
+		return true
+	case !unicode.Is(extendedPictographic, r):
+		return false
+	}
+	return r >= 0x1f000 || next == '\ufe0f' || unicode.Is(emojiPresentation, r)
+}
+
+// extendedPictographic is the Extended_Pictographic property of Unicode 15,
+// the characters emoji can be made of.
+var extendedPictographic = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x00a9, 0x00a9, 1}, {0x00ae, 0x00ae, 1}, {0x203c, 0x203c, 1},
+		{0x2049, 0x2049, 1}, {0x2122, 0x2122, 1}, {0x2139, 0x2139, 1},
+		{0x2194, 0x2199, 1}, {0x21a9, 0x21aa, 1}, {0x231a, 0x231b, 1},
+		{0x2328, 0x2328, 1}, {0x2388, 0x2388, 1}, {0x23cf, 0x23cf, 1},
+		{0x23e9, 0x23f3, 1}, {0x23f8, 0x23fa, 1}, {0x24c2, 0x24c2, 1},
+		{0x25aa, 0x25ab, 1}, {0x25b6, 0x25b6, 1}, {0x25c0, 0x25c0, 1},
+		{0x25fb, 0x25fe, 1}, {0x2600, 0x2605, 1}, {0x2607, 0x2612, 1},
+		{0x2614, 0x2685, 1}, {0x2690, 0x2705, 1}, {0x2708, 0x2712, 1},
+		{0x2714, 0x2714, 1}, {0x2716, 0x2716, 1}, {0x271d, 0x271d, 1},
+		{0x2721, 0x2721, 1}, {0x2728, 0x2728, 1}, {0x2733, 0x2734, 1},
+		{0x2744, 0x2744, 1}, {0x2747, 0x2747, 1}, {0x274c, 0x274c, 1},
+		{0x274e, 0x274e, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1},
+		{0x2763, 0x2767, 1}, {0x2795, 0x2797, 1}, {0x27a1, 0x27a1, 1},
+		{0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1}, {0x2934, 0x2935, 1},
+		{0x2b05, 0x2b07, 1}, {0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1},
+		{0x2b55, 0x2b55, 1}, {0x3030, 0x3030, 1}, {0x303d, 0x303d, 1},
+		{0x3297, 0x3297, 1}, {0x3299, 0x3299, 1},
+	},
+	R32: []unicode.Range32{
+		{0x1f000, 0x1f0ff, 1}, {0x1f10d, 0x1f10f, 1}, {0x1f12f, 0x1f12f, 1},
+		{0x1f16c, 0x1f171, 1}, {0x1f17e, 0x1f17f, 1}, {0x1f18e, 0x1f18e, 1},
+		{0x1f191, 0x1f19a, 1}, {0x1f1ad, 0x1f1e5, 1}, {0x1f201, 0x1f20f, 1},
+		{0x1f21a, 0x1f21a, 1}, {0x1f22f, 0x1f22f, 1}, {0x1f232, 0x1f23a, 1},
+		{0x1f23c, 0x1f23f, 1}, {0x1f249, 0x1f3fa, 1}, {0x1f400, 0x1f53d, 1},
+		{0x1f546, 0x1f64f, 1}, {0x1f680, 0x1f6ff, 1}, {0x1f774, 0x1f77f, 1},
+		{0x1f7d5, 0x1f7ff, 1}, {0x1f80c, 0x1f80f, 1}, {0x1f848, 0x1f84f, 1},
+		{0x1f85a, 0x1f85f, 1}, {0x1f888, 0x1f88f, 1}, {0x1f8ae, 0x1f8ff, 1},
+		{0x1f90c, 0x1f93a, 1}, {0x1f93c, 0x1f945, 1}, {0x1f947, 0x1faff, 1},
+		{0x1fc00, 0x1fffd, 1},
+	},
+	LatinOffset: 2,
+}
+
+// emojiPresentation is the part of the Emoji_Presentation property of
+// Unicode 15 below U+1F000: pictographs shown as emoji even without a
+// variation selector, like ⚡ or ☕.
+var emojiPresentation = &unicode.RangeTable{
+	R16: []unicode.Range16{
+		{0x231a, 0x231b, 1}, {0x23e9, 0x23ec, 1}, {0x23f0, 0x23f0, 1},
+		{0x23f3, 0x23f3, 1}, {0x25fd, 0x25fe, 1}, {0x2614, 0x2615, 1},
+		{0x2648, 0x2653, 1}, {0x267f, 0x267f, 1}, {0x2693, 0x2693, 1},
+		{0x26a1, 0x26a1, 1}, {0x26aa, 0x26ab, 1}, {0x26bd, 0x26be, 1},
+		{0x26c4, 0x26c5, 1}, {0x26ce, 0x26ce, 1}, {0x26d4, 0x26d4, 1},
+		{0x26ea, 0x26ea, 1}, {0x26f2, 0x26f3, 1}, {0x26f5, 0x26f5, 1},
+		{0x26fa, 0x26fa, 1}, {0x26fd, 0x26fd, 1}, {0x2705, 0x2705, 1},
+		{0x270a, 0x270b, 1}, {0x2728, 0x2728, 1}, {0x274c, 0x274c, 1},
+		{0x274e, 0x274e, 1}, {0x2753, 0x2755, 1}, {0x2757, 0x2757, 1},
+		{0x2795, 0x2797, 1}, {0x27b0, 0x27b0, 1}, {0x27bf, 0x27bf, 1},
+		{0x2b1b, 0x2b1c, 1}, {0x2b50, 0x2b50, 1}, {0x2b55, 0x2b55, 1},
+	},
+}
+
+// continuesEmoji reports whether r belongs to the emoji that prev is part
+// of: a skin tone, variation selector, keycap, the emoji after a zero width
+// joiner, or the second half of a flag. regional counts the regional
+// indicators of the emoji so far.
+func continuesEmoji(prev, r rune, regional int) bool {
+	switch {
+	case r == '\u200d' || r == '\ufe0f' || r == '\u20e3':
+		return true
+	case r >= 0x1f3fb && r <= 0x1f3ff:
+		return true
+	case prev == '\u200d':
+		return true
+	}
+	return isRegionalIndicator(r) && regional%2 == 1
+}
+
+// isRegionalIndicator reports whether r is one of the letters flags are made of.
+func isRegionalIndicator(r rune) bool {
+	return r >= 0x1f1e6 && r <= 0x1f1ff
+}
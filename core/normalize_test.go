@@ -0,0 +1,42 @@
+package core
+
+import "testing"
+
+func TestNormalizer(t *testing.T) {
+	tests := []struct {
+		name       string
+		normalizer Normalizer
+		in, want   string
+	}{
+		{"zero value", Normalizer{}, "Ｈｉ,  안녕!", "Ｈｉ,  안녕!"},
+		{"default", DefaultNormalizer(), "  Ｈｅｌｌｏ,   안녕!! ", "hello , 안녕 ! !"},
+		{"nfc joins jamo", Normalizer{Form: NFC}, "\u1100\u1161", "가"},
+		{"half-width hangul", Normalizer{FoldWidth: true}, "ﾡ", "ㄱ"},
+		{"nfkc folds width", Normalizer{Form: NFKC}, "Ｈｉ ﾡ", "Hi \u1100"},
+		{"urls", DefaultNormalizer(), "링크: https://a.com/x?y=1. (www.b.kr/)", "링크 : https://a.com/x?y=1 . ( www.b.kr/ )"},
+		{"numbers", DefaultNormalizer(), "3.5배, 1,000원. 끝.", "3.5배 , 1,000원 . 끝 ."},
+		{"symbols are not emoji", DefaultNormalizer(), "©2024 30° →★ ♥ ─", "©2024 30° →★ ♥ ─"},
+		{"emoji", DefaultNormalizer(), "♥\ufe0f좋아⚡최고🎉", "♥\ufe0f 좋아 ⚡ 최고 🎉"},
+		{"apostrophes", DefaultNormalizer(), "'hello' don't", "' hello ' don't"},
+	}
+	for _, tt := range tests {
+		if got := tt.normalizer.Normalize(tt.in); got != tt.want {
+			t.Errorf("%s: Normalize(%q) = %q, want %q", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestExtractorMatchesNormalizedTokens(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.Normalizer = DefaultNormalizer()
+	tokenizer.AddtoModel("안녕! 오늘 날씨가 좋네요")
+	tokenizer.BuildUnigramMap()
+
+	if _, ok := tokenizer.GetTokenIndex("안녕"); !ok {
+		t.Fatalf("안녕 is not a token, tokens: %v", tokenizer.TokenList)
+	}
+	keywords := NewExtractor(NewNGramModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 2)).Extract("<p>안녕!!</p>", 0)
+	if len(keywords) != 1 || keywords[0].Token != "안녕" {
+		t.Errorf("Extract = %v, want 안녕", keywords)
+	}
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+// Learn updates a trained model with new texts, such as posts read from a
+// timeline. The texts are counted in the model's Lexicon and Stats, the weights grow to cover
+// any new tokens (see GrowVocabulary), and steps SGD updates at the model's LearningRate are run
+// on the rows of every token the texts contain. Other rows are left alone.
+// Once the vocabulary was pruned, unknown words count as UNKTOKEN instead
+// of becoming new tokens.
+// It returns the mean loss of those rows before the first update, or
+// ErrUnsupportedTokenizer when the model's Lexicon and Stats cannot count
+// new texts.
+func (m *LinearModel) Learn(texts []string, steps int) (float32, error) {
+	tokenizer, err := tokenizerOf(m.Lexicon, m.Stats)
+	if err != nil {
+		return 0, err
+	}
+
+	// 1. Count the new transitions
+	touched := make(map[int]bool)
+	for _, text := range texts {
+		indices := tokenizer.addText(text, true)
+		if len(indices) == 0 {
+			continue
+		}
+		// Every token but the final ENDTOKEN gained a successor
+		for _, tokIdx := range indices[:len(indices)-1] {
+			touched[tokIdx] = true
+		}
+		m.Meta.CorpusSize++
+	}
+	if len(touched) == 0 {
+		return 0, nil
+	}
+
+	// Sorted so the updates do not depend on map order
+	rows := make([]int, 0, len(touched))
+	for tokIdx := range touched {
+		rows = append(rows, tokIdx)
+		tokenizer.updateUnigramMap(tokIdx)
+	}
+	sort.Ints(rows)
+
+	// 2. Make room for new tokens
+	m.GrowVocabulary()
+
+	// 3. Update the touched rows
+	var grad []float32
+	var loss, firstLoss float32
+	sgd := &SGD{}
+	for step := 0; step < steps; step++ {
+		totalLoss := float32(0.0)
+		for _, tokIdx := range rows {
+			grad, loss = m.Weights.Backward(tokIdx, trainingTarget(m.Stats, m.Objective, tokIdx), grad)
+			totalLoss += loss
+			sgd.Step(tokIdx, m.Weights.Params(tokIdx), grad, m.LearningRate)
+		}
+		if step == 0 {
+			firstLoss = totalLoss / float32(len(rows))
+		}
+	}
+	return firstLoss, nil
+}
+
+// GrowVocabulary resizes the weights after tokens were added to the
+// lexicon, for example with Tokenizer.AddtoModel. Rows of new tokens start from the
+// log of their successor counts, so they predict sensibly before any
+// training. New columns of existing dense rows start at the lowest score of
+// the row, and those of sparse rows at the row's shared value, so new tokens
+// are not suddenly preferred over the ones the row was trained on.
+func (m *LinearModel) GrowVocabulary() {
+	vocabSize := m.Lexicon.Size()
+	oldSize := m.Weights.Size()
+	if vocabSize <= oldSize {
+		return
+	}
+
+	switch w := m.Weights.(type) {
+	case DenseWeights:
+		for i := range w {
+			lowest := float32(0.0)
+			for j, v := range w[i] {
+				if j == 0 || v < lowest {
+					lowest = v
+				}
+			}
+			for j := len(w[i]); j < vocabSize; j++ {
+				w[i] = append(w[i], lowest)
+			}
+		}
+		for i := oldSize; i < vocabSize; i++ {
+			w = append(w, countScores(m.Stats.Successors(i), vocabSize))
+		}
+		m.Weights = w
+	case *SparseWeights:
+		for i := oldSize; i < vocabSize; i++ {
+			w.Rows = append(w.Rows, countRow(m.Stats.Successors(i), vocabSize))
+		}
+		w.N = vocabSize
+	}
+}
+
+// countScores returns log-count scores for a row with the successor counts
+// freq: log(count) for observed successors and log(1/vocabSize) for the
+// rest, as if one more occurrence were spread over the unseen tokens.
+func countScores(freq map[int]int, vocabSize int) []float32 {
+	unseen := float32(-math.Log(float64(vocabSize)))
+	scores := make([]float32, vocabSize)
+	for j := range scores {
+		scores[j] = unseen
+	}
+	for nextID, count := range freq {
+		if nextID < vocabSize {
+			scores[nextID] = float32(math.Log(float64(count)))
+		}
+	}
+	return scores
+}
+
+// countRow is countScores for a SparseWeights row.
+func countRow(freq map[int]int, vocabSize int) SparseRow {
+	cols := make([]int32, 0, len(freq))
+	for nextID := range freq {
+		if nextID < vocabSize {
+			cols = append(cols, int32(nextID))
+		}
+	}
+	sort.Slice(cols, func(a, b int) bool { return cols[a] < cols[b] })
+
+	vals := make([]float32, len(cols)+1)
+	for k, col := range cols {
+		vals[k] = float32(math.Log(float64(freq[int(col)])))
+	}
+	vals[len(cols)] = float32(-math.Log(float64(vocabSize)))
+	return SparseRow{Cols: cols, Vals: vals}
+}
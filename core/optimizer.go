@@ -0,0 +1,171 @@
+package core
+
+import (
+	"encoding/gob"
+	"math"
+)
+
+func init() {
+	// Optimizers are stored in checkpoints behind the interface.
+	gob.Register(&SGD{})
+	gob.Register(&Momentum{})
+	gob.Register(&Adam{})
+}
+
+// Optimizer updates the parameters of one row of a LinearModel from its
+// gradient. Steps on different rows may run concurrently.
+type Optimizer interface {
+	// Resize makes room for the state of rows rows. It is called before
+	// every training run, never concurrently with Step.
+	Resize(rows int)
+	// Step applies grad to params, the parameters of row, with the given
+	// learning rate.
+	Step(row int, params, grad []float32, rate float32)
+}
+
+// SGD is plain stochastic gradient descent with optional L2 weight decay.
+type SGD struct {
+	WeightDecay float32
+}
+
+func (o *SGD) Resize(rows int) {}
+
+func (o *SGD) Step(row int, params, grad []float32, rate float32) {
+	for k := range params {
+		params[k] -= rate * (grad[k] + o.WeightDecay*params[k])
+	}
+}
+
+// Momentum is gradient descent with classical momentum.
+type Momentum struct {
+	Beta     float32 // Fraction of the previous update kept, typically 0.9
+	Velocity [][]float32
+}
+
+// NewMomentum creates a Momentum optimizer.
+func NewMomentum(beta float32) *Momentum {
+	return &Momentum{Beta: beta}
+}
+
+func (o *Momentum) Resize(rows int) {
+	o.Velocity = growState(o.Velocity, rows)
+}
+
+func (o *Momentum) Step(row int, params, grad []float32, rate float32) {
+	velocity := rowState(&o.Velocity[row], len(params))
+	for k := range params {
+		velocity[k] = o.Beta*velocity[k] + grad[k]
+		params[k] -= rate * velocity[k]
+	}
+}
+
+// Adam is the Adam optimizer with per-row bias correction.
+type Adam struct {
+	Beta1, Beta2 float32
+	Epsilon      float32
+	M, V         [][]float32 // First and second moment estimates
+	Steps        []int32     // Updates applied to each row
+}
+
+// NewAdam creates an Adam optimizer with the usual defaults.
+func NewAdam() *Adam {
+	return &Adam{Beta1: 0.9, Beta2: 0.999, Epsilon: 1e-8}
+}
+
+func (o *Adam) Resize(rows int) {
+	o.M = growState(o.M, rows)
+	o.V = growState(o.V, rows)
+	if len(o.Steps) < rows {
+		o.Steps = append(o.Steps, make([]int32, rows-len(o.Steps))...)
+	}
+}
+
+func (o *Adam) Step(row int, params, grad []float32, rate float32) {
+	if len(o.M[row]) != len(params) {
+		o.Steps[row] = 0 // New or resized row, restart bias correction
+	}
+	m := rowState(&o.M[row], len(params))
+	v := rowState(&o.V[row], len(params))
+	o.Steps[row]++
+
+	t := float64(o.Steps[row])
+	correction1 := float32(1 - math.Pow(float64(o.Beta1), t))
+	correction2 := float32(1 - math.Pow(float64(o.Beta2), t))
+	for k := range params {
+		m[k] = o.Beta1*m[k] + (1-o.Beta1)*grad[k]
+		v[k] = o.Beta2*v[k] + (1-o.Beta2)*grad[k]*grad[k]
+		mHat := m[k] / correction1
+		vHat := v[k] / correction2
+		params[k] -= rate * mHat / (float32(math.Sqrt(float64(vHat))) + o.Epsilon)
+	}
+}
+
+// growState extends per-row optimizer state to rows rows.
+func growState(state [][]float32, rows int) [][]float32 {
+	if len(state) < rows {
+		state = append(state, make([][]float32, rows-len(state))...)
+	}
+	return state
+}
+
+// rowState returns the state of one row, reset to zeros when the row has no
+// state yet or its number of parameters changed (a sparse row gained entries).
+func rowState(state *[]float32, n int) []float32 {
+	if len(*state) != n {
+		*state = make([]float32, n)
+	}
+	return *state
+}
+
+// Schedule gives the learning rate of an epoch.
+type Schedule interface {
+	Rate(base float32, epoch, epochs int) float32
+}
+
+// ConstantSchedule keeps the base learning rate.
+type ConstantSchedule struct{}
+
+func (ConstantSchedule) Rate(base float32, epoch, epochs int) float32 { return base }
+
+// StepDecay multiplies the learning rate by Gamma every Every epochs.
+type StepDecay struct {
+	Every int
+	Gamma float32
+}
+
+func (s StepDecay) Rate(base float32, epoch, epochs int) float32 {
+	if s.Every <= 0 {
+		return base
+	}
+	return base * float32(math.Pow(float64(s.Gamma), float64(epoch/s.Every)))
+}
+
+// CosineSchedule anneals the learning rate from base to MinRate over the run.
+type CosineSchedule struct {
+	MinRate float32
+}
+
+func (s CosineSchedule) Rate(base float32, epoch, epochs int) float32 {
+	if epochs <= 1 {
+		return base
+	}
+	progress := float64(epoch) / float64(epochs-1)
+	return s.MinRate + (base-s.MinRate)*float32(0.5*(1+math.Cos(math.Pi*progress)))
+}
+
+// Warmup ramps the learning rate up linearly over the first Epochs epochs,
+// then follows Then (constant when nil) over the remaining epochs.
+type Warmup struct {
+	Epochs int
+	Then   Schedule
+}
+
+func (s Warmup) Rate(base float32, epoch, epochs int) float32 {
+	if epoch < s.Epochs {
+		return base * float32(epoch+1) / float32(s.Epochs+1)
+	}
+	if s.Then == nil {
+		return base
+	}
+	return s.Then.Rate(base, epoch-s.Epochs, epochs-s.Epochs)
+}
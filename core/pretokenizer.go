@@ -0,0 +1,219 @@
+package core
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SuffixMarker starts tokens that attach to the previous token without a
+// space, such as the particles split off by the Korean pre-tokenizer.
+const SuffixMarker = "##"
+
+// PreTokenizer splits text into the tokens counted by a Tokenizer and joins
+// generated tokens back into text.
+type PreTokenizer interface {
+	Split(text string) []string
+	Join(tokens []string) string
+}
+
+// Names of the built-in pre-tokenizers.
+const (
+	WhitespacePreTokenizer = "whitespace"
+	KoreanPreTokenizer     = "korean"
+)
+
+var (
+	preTokenizersMu sync.RWMutex
+	preTokenizers   = map[string]PreTokenizer{
+		WhitespacePreTokenizer: whitespaceSplitter{},
+		KoreanPreTokenizer:     NewKoreanSplitter(),
+	}
+)
+
+// RegisterPreTokenizer makes p available to tokenizers under name.
+// Tokenizers store only the name, so p must be registered again before
+// loading a model that uses it. It is safe to call concurrently with
+// tokenizers in use, which keep the pre-tokenizer they already looked up.
+func RegisterPreTokenizer(name string, p PreTokenizer) {
+	preTokenizersMu.Lock()
+	defer preTokenizersMu.Unlock()
+	preTokenizers[name] = p
+}
+
+// LookupPreTokenizer returns the pre-tokenizer registered under name.
+// The empty name is the whitespace pre-tokenizer of older models.
+func LookupPreTokenizer(name string) (PreTokenizer, bool) {
+	if name == "" {
+		name = WhitespacePreTokenizer
+	}
+	preTokenizersMu.RLock()
+	defer preTokenizersMu.RUnlock()
+	p, ok := preTokenizers[name]
+	return p, ok
+}
+
+// whitespaceSplitter splits on whitespace; every word is a token.
+type whitespaceSplitter struct{}
+
+func (whitespaceSplitter) Split(text string) []string { return strings.Fields(text) }
+
+func (whitespaceSplitter) Join(tokens []string) string { return joinTokens(tokens, nil) }
+
+// KoreanSplitter separates common particles (josa) and endings (eomi) from
+// the stem of each Korean word, so "학교에" and "학교를" share the token
+// "학교" followed by "##에" or "##를". It matches the longest known suffix.
+// Many nouns end in a syllable that is also a suffix, like 바다 or 사과, so a
+// one-syllable suffix is only split from a stem of two syllables or more,
+// and a few longer nouns such as 고양이 are never split.
+type KoreanSplitter struct {
+	suffixes []string // Longest first
+	words    map[string]bool
+}
+
+// koreanSuffixes are the particles and endings split off by default.
+var koreanSuffixes = []string{
+	// Particles
+	"은", "는", "이", "가", "을", "를", "에", "에서", "에게", "께서", "한테",
+	"와", "과", "도", "만", "의", "로", "으로", "까지", "부터", "처럼", "보다",
+	"이랑", "랑", "이나", "에는", "에서는", "으로는", "로는", "에도", "에서도",
+	"만큼", "밖에", "조차", "마저", "께",
+	// Endings
+	"다", "었다", "았다", "였다", "했다", "습니다", "어요", "아요",
+	"해요", "니다", "었어요", "았어요", "였어요", "했어요", "요", "고", "며", "면",
+	"지만", "는데", "은데", "니까", "어서", "아서", "해서", "면서", "지요",
+	"죠", "네요", "군요", "겠다", "겠어요",
+}
+
+// koreanWords are common nouns of three syllables or more that end like a
+// suffix, kept whole by default.
+var koreanWords = []string{
+	"고양이", "어린이", "원숭이", "호랑이", "목걸이", "귀걸이", "멍멍이",
+	"냉장고", "제주도", "경기도", "강원도", "짜장면", "대학로",
+}
+
+// NewKoreanSplitter creates a KoreanSplitter with the default suffixes and
+// words.
+func NewKoreanSplitter() *KoreanSplitter {
+	return NewKoreanSplitterWithSuffixes(koreanSuffixes, koreanWords)
+}
+
+// NewKoreanSplitterWithSuffixes creates a KoreanSplitter splitting off
+// suffixes, except from the given words, which are kept whole.
+func NewKoreanSplitterWithSuffixes(suffixes, words []string) *KoreanSplitter {
+	sorted := append([]string(nil), suffixes...)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		return utf8.RuneCountInString(sorted[a]) > utf8.RuneCountInString(sorted[b])
+	})
+	s := &KoreanSplitter{suffixes: sorted, words: make(map[string]bool, len(words))}
+	for _, word := range words {
+		s.words[word] = true
+	}
+	return s
+}
+
+func (s *KoreanSplitter) Split(text string) []string {
+	var tokens []string
+	for _, word := range strings.Fields(text) {
+		stem, suffix := s.splitWord(word)
+		tokens = append(tokens, stem)
+		if suffix != "" {
+			tokens = append(tokens, SuffixMarker+suffix)
+		}
+	}
+	return tokens
+}
+
+// splitWord returns the stem and suffix of word, or word and "" when no
+// suffix applies.
+func (s *KoreanSplitter) splitWord(word string) (string, string) {
+	if !isHangulWord(word) || s.words[word] {
+		return word, ""
+	}
+	for _, suffix := range s.suffixes {
+		stem, ok := strings.CutSuffix(word, suffix)
+		if !ok || stem == "" {
+			continue
+		}
+		// A lone syllable before a one-syllable suffix is more likely a
+		// noun, like 바다 or 지도, than a stem and its suffix.
+		if utf8.RuneCountInString(suffix) == 1 && utf8.RuneCountInString(stem) < 2 {
+			continue
+		}
+		return stem, suffix
+	}
+	return word, ""
+}
+
+func (s *KoreanSplitter) Join(tokens []string) string {
+	return joinTokens(tokens, nil)
+}
+
+// joinTokens joins tokens into text. SuffixMarker tokens continue the word
+// before them; the other tokens start words, which are separated by spaces
+// except around punctuation and emoji (see attachesLeft and attachesRight).
+// Straight quotes, which look the same on both sides, alternate between
+// opening and closing. decode, if not nil, turns each piece into the text
+// it stands for.
+func joinTokens(tokens []string, decode func(string) string) string {
+	var words []string
+	for _, token := range tokens {
+		piece, attached := strings.CutPrefix(token, SuffixMarker)
+		if decode != nil {
+			piece = decode(piece)
+		}
+		if attached && len(words) > 0 {
+			words[len(words)-1] += piece
+		} else {
+			words = append(words, piece)
+		}
+	}
+
+	var sb strings.Builder
+	opened := make(map[string]bool) // Straight quotes waiting to be closed
+	attachNext := false
+	for i, word := range words {
+		left, right := attachesLeft(word), attachesRight(word)
+		if word == "'" || word == "\"" {
+			left, right = opened[word], !opened[word]
+			opened[word] = !opened[word]
+		}
+		if i > 0 && !left && !attachNext {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(word)
+		attachNext = right
+	}
+	return sb.String()
+}
+
+// closingPunctuation are the punctuation marks, besides closing brackets
+// and quotes, written right after the word before them.
+const closingPunctuation = ".,!?;:…。、！？~"
+
+// attachesLeft reports whether word is closing punctuation or an emoji,
+// written without a space after the word before it.
+func attachesLeft(word string) bool {
+	r, size := utf8.DecodeRuneInString(word)
+	next, _ := utf8.DecodeRuneInString(word[size:])
+	return word != "" && (unicode.In(r, unicode.Pe, unicode.Pf) || strings.ContainsRune(closingPunctuation, r) || isEmoji(r, next))
+}
+
+// attachesRight reports whether word is an opening bracket or quote,
+// written without a space before the word after it.
+func attachesRight(word string) bool {
+	r, _ := utf8.DecodeRuneInString(word)
+	return word != "" && unicode.In(r, unicode.Ps, unicode.Pi)
+}
+
+// isHangulWord reports whether word consists of Hangul only.
+func isHangulWord(word string) bool {
+	for _, r := range word {
+		if !unicode.Is(unicode.Hangul, r) {
+			return false
+		}
+	}
+	return word != ""
+}
@@ -0,0 +1,103 @@
+package core
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestKoreanSplitter(t *testing.T) {
+	splitter := NewKoreanSplitter()
+	text := "나는 학교에 갔다 hello 오늘"
+
+	tokens := splitter.Split(text)
+	want := []string{"나는", "학교", "##에", "갔다", "hello", "오늘"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Split(%q) = %q, want %q", text, tokens, want)
+	}
+	if got := splitter.Join(tokens); got != text {
+		t.Errorf("Join(Split(%q)) = %q", text, got)
+	}
+}
+
+func TestKoreanSplitterKeepsNouns(t *testing.T) {
+	splitter := NewKoreanSplitter()
+	for _, word := range []string{"바다", "아이", "사과", "지도", "회의", "정도", "온도", "고양이", "제주도"} {
+		if got := splitter.Split(word); !reflect.DeepEqual(got, []string{word}) {
+			t.Errorf("Split(%q) = %q, want the noun whole", word, got)
+		}
+	}
+
+	tests := map[string][]string{
+		"바다에서": {"바다", "##에서"},
+		"사과를":  {"사과", "##를"},
+		"고양이가": {"고양이", "##가"},
+		"좋아요":  {"좋", "##아요"},
+		"먹었다":  {"먹", "##었다"},
+	}
+	for word, want := range tests {
+		if got := splitter.Split(word); !reflect.DeepEqual(got, want) {
+			t.Errorf("Split(%q) = %q, want %q", word, got, want)
+		}
+	}
+}
+
+func TestTokenizerUsesPreTokenizer(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.PreTokenizer = KoreanPreTokenizer
+	tokenizer.AddtoModel("학교에 갔다")
+	tokenizer.AddtoModel("학교를 좋아한다")
+	tokenizer.BuildUnigramMap()
+
+	school, ok := tokenizer.GetTokenIndex("학교")
+	if !ok {
+		t.Fatal("학교 is not a token")
+	}
+	if got := len(tokenizer.UnigramFreq[school]); got != 2 {
+		t.Errorf("학교 has %d successors, want 2 (##에 and ##를)", got)
+	}
+
+	// The pre-tokenizer is stored with the model.
+	var buf bytes.Buffer
+	model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1)
+	if _, err := model.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := ReadModel(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := loaded.Lexicon.Detokenize(loaded.Lexicon.Tokenize("학교에 갔다")); got != "학교에 갔다" {
+		t.Errorf("loaded tokenizer round trip = %q", got)
+	}
+	if got := loaded.Lexicon.(*Vocabulary).PreTokenizer; got != KoreanPreTokenizer {
+		t.Errorf("loaded pre-tokenizer %q, want %q", got, KoreanPreTokenizer)
+	}
+}
+
+func TestPunctuationAndEmojiTokens(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.Normalizer = DefaultNormalizer()
+	tokenizer.PreTokenizer = KoreanPreTokenizer
+
+	text := "오늘 (정말) 좋아요!! 👍🏻 #주말"
+	tokens := tokenizer.Tokenize(text)
+	want := []string{"오늘", "(", "정말", ")", "좋", "##아요", "!", "!", "👍🏻", "#주말"}
+	if !reflect.DeepEqual(tokens, want) {
+		t.Errorf("Tokenize(%q) = %q, want %q", text, tokens, want)
+	}
+	if got, want := tokenizer.Detokenize(tokens), "오늘 (정말) 좋아요!!👍🏻 #주말"; got != want {
+		t.Errorf("Detokenize = %q, want %q", got, want)
+	}
+
+	// Straight quotes open and close in turn.
+	tokens = []string{"'", "hello", "'", "don't", "\"", "안녕", "\"", "했다"}
+	if got, want := tokenizer.Detokenize(tokens), "'hello' don't \"안녕\" 했다"; got != want {
+		t.Errorf("Detokenize(%q) = %q, want %q", tokens, got, want)
+	}
+
+	// Flags and joined emoji stay whole.
+	if got := tokenizer.Tokenize("🇰🇷🇯🇵 👨‍👩‍👧"); !reflect.DeepEqual(got, []string{"🇰🇷", "🇯🇵", "👨‍👩‍👧"}) {
+		t.Errorf("emoji tokens = %q", got)
+	}
+}
@@ -0,0 +1,173 @@
+package core
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// UNKTOKEN stands for every word removed from the vocabulary by Prune.
+const UNKTOKEN = "[<UNK>]"
+
+// isSpecialToken reports whether token is a marker rather than a word.
+// Special tokens are never pruned.
+func isSpecialToken(token string) bool {
+	return token == ENDTOKEN || token == BOTTOKEN || token == UNKTOKEN
+}
+
+// Prune removes rare tokens from the vocabulary. Tokens seen fewer than
+// minCount times are removed, and when maxVocab is positive only the
+// maxVocab most frequent tokens (special tokens included) are kept.
+// Removed tokens are merged into UNKTOKEN, which is added when needed, and
+// the remaining indices are compacted in their original order, so any model
+// built on the tokenizer before pruning no longer matches it.
+// It returns the number of tokens removed.
+func (t *Tokenizer) Prune(minCount, maxVocab int) int {
+	counts := t.tokenCounts(t.Count)
+
+	// 1. Choose the tokens to keep
+	keep := make([]bool, t.Count)
+	reserved := 0
+	if _, exists := t.Tokens[UNKTOKEN]; !exists {
+		reserved++ // Room for the UNKTOKEN to be added
+	}
+	var candidates []int
+	for idx, token := range t.TokenList {
+		switch {
+		case isSpecialToken(token):
+			keep[idx] = true
+			reserved++
+		case counts[idx] >= minCount:
+			candidates = append(candidates, idx)
+		}
+	}
+	if maxVocab > 0 && len(candidates) > maxVocab-reserved {
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return counts[candidates[a]] > counts[candidates[b]]
+		})
+		budget := maxVocab - reserved
+		if budget < 0 {
+			budget = 0
+		}
+		candidates = candidates[:budget]
+	}
+	for _, idx := range candidates {
+		keep[idx] = true
+	}
+
+	removed := 0
+	for _, kept := range keep {
+		if !kept {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0
+	}
+
+	// 2. Compact the indices, mapping removed tokens to UNKTOKEN
+	remap := make([]int, t.Count)
+	var tokenList []string
+	for idx, kept := range keep {
+		if kept {
+			remap[idx] = len(tokenList)
+			tokenList = append(tokenList, t.TokenList[idx])
+		}
+	}
+	unkIdx := len(tokenList)
+	if idx, exists := t.Tokens[UNKTOKEN]; exists {
+		unkIdx = remap[idx]
+	} else {
+		tokenList = append(tokenList, UNKTOKEN)
+	}
+	for idx, kept := range keep {
+		if !kept {
+			remap[idx] = unkIdx
+		}
+	}
+
+	t.TokenList = tokenList
+	t.Count = len(tokenList)
+	t.Tokens = make(map[string]int, t.Count)
+	for idx, token := range tokenList {
+		t.Tokens[token] = idx
+	}
+
+	// 3. Merge the counts of removed tokens into UNKTOKEN
+	unigramFreq := make(map[int]map[int]int, len(t.UnigramFreq))
+	for tokIdx, freqMap := range t.UnigramFreq {
+		unigramFreq[remap[tokIdx]] = mergeCounts(unigramFreq[remap[tokIdx]], freqMap, remap)
+	}
+	t.UnigramFreq = unigramFreq
+
+	if t.ContextFreq != nil {
+		contextFreq := make(map[string]map[int]int, len(t.ContextFreq))
+		for key, freqMap := range t.ContextFreq {
+			key = remapContextKey(key, remap)
+			contextFreq[key] = mergeCounts(contextFreq[key], freqMap, remap)
+		}
+		t.ContextFreq = contextFreq
+	}
+
+	t.UnigramMap = make(map[int]int)
+	t.BuildUnigramMap()
+
+	return removed
+}
+
+// tokenCounts returns how often each of the first n tokens occurred. Every
+// occurrence has exactly one successor, ENDTOKEN at the end of a text.
+func (c *TransitionCounts) tokenCounts(n int) []int {
+	counts := make([]int, n)
+	for tokIdx, freqMap := range c.UnigramFreq {
+		if tokIdx >= n {
+			continue
+		}
+		for _, freq := range freqMap {
+			counts[tokIdx] += freq
+		}
+	}
+	return counts
+}
+
+// mergeCounts adds freqMap, with its successors remapped, to dst.
+func mergeCounts(dst, freqMap map[int]int, remap []int) map[int]int {
+	if dst == nil {
+		dst = make(map[int]int, len(freqMap))
+	}
+	for nextID, freq := range freqMap {
+		dst[remap[nextID]] += freq
+	}
+	return dst
+}
+
+// remapContextKey rewrites the indices of a ContextFreq key.
+func remapContextKey(key string, remap []int) string {
+	parts := strings.Fields(key)
+	indices := make([]int, len(parts))
+	for i, part := range parts {
+		idx, _ := strconv.Atoi(part)
+		indices[i] = remap[idx]
+	}
+	return contextKey(indices)
+}
+
+// lookup returns the index of word, or that of UNKTOKEN when word is not in
+// lexicon and lexicon was pruned.
+func lookup(lexicon Lexicon, word string) (int, bool) {
+	if idx, exists := lexicon.GetTokenIndex(word); exists {
+		return idx, true
+	}
+	return lexicon.GetTokenIndex(UNKTOKEN)
+}
+
+// maskSpecial keeps BOTTOKEN and UNKTOKEN of lexicon from being predicted by
+// setting their scores to -Inf.
+func maskSpecial(lexicon Lexicon, scores []float32) {
+	for _, token := range []string{BOTTOKEN, UNKTOKEN} {
+		if idx, exists := lexicon.GetTokenIndex(token); exists && idx < len(scores) {
+			scores[idx] = float32(math.Inf(-1))
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package core
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// SamplingConfig controls how the next token is chosen from the model scores.
+// A nil *SamplingConfig, or one with Temperature <= 0, decodes greedily.
+type SamplingConfig struct {
+	// Temperature divides the scores before softmax. Values below 1 sharpen
+	// the distribution, values above 1 flatten it. 0 means greedy decoding.
+	Temperature float32
+	// TopK keeps only the K most probable tokens. 0 disables the filter.
+	TopK int
+	// TopP keeps the smallest set of tokens whose cumulative probability
+	// reaches P (nucleus sampling). 0 or 1 disables the filter.
+	TopP float32
+	// Rand is the random source used for sampling. If nil, the global
+	// math/rand source is used.
+	Rand *rand.Rand
+
+	// RepetitionPenalty scales down the score of every token already in the
+	// history (CTRL style). 0 or 1 disables it.
+	RepetitionPenalty float32
+	// PresencePenalty is subtracted once from the score of every token
+	// already in the history.
+	PresencePenalty float32
+	// FrequencyPenalty is subtracted from the score of a token once per
+	// occurrence in the history.
+	FrequencyPenalty float32
+	// NoRepeatNGramSize forbids any n-gram of this size from appearing twice.
+	// 0 disables the rule.
+	NoRepeatNGramSize int
+}
+
+// GreedySampling returns a config that always picks the most probable token.
+func GreedySampling() *SamplingConfig {
+	return &SamplingConfig{}
+}
+
+// NewSamplingConfig creates a sampling config with a source seeded by seed.
+func NewSamplingConfig(temperature float32, topK int, topP float32, seed int64) *SamplingConfig {
+	return &SamplingConfig{
+		Temperature: temperature,
+		TopK:        topK,
+		TopP:        topP,
+		Rand:        rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Sample picks a token index from the raw scores.
+// generatedTokens is the history the penalties are computed from, ending with
+// the current token. The scores slice may be modified.
+func (c *SamplingConfig) Sample(scores []float32, generatedTokens []int) int {
+	if len(scores) == 0 {
+		return 0
+	}
+	if c == nil {
+		return argmax(scores)
+	}
+
+	c.applyPenalties(scores, generatedTokens)
+
+	if c.Temperature <= 0 {
+		return argmax(scores)
+	}
+
+	for i := range scores {
+		scores[i] /= c.Temperature
+	}
+	probabilities := softmax(scores)
+
+	// Sort candidates by probability so top-k and top-p can cut the tail.
+	candidates := make([]int, len(probabilities))
+	for i := range candidates {
+		candidates[i] = i
+	}
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return probabilities[candidates[a]] > probabilities[candidates[b]]
+	})
+
+	if c.TopK > 0 && c.TopK < len(candidates) {
+		candidates = candidates[:c.TopK]
+	}
+
+	if c.TopP > 0 && c.TopP < 1 {
+		cumulative := float32(0.0)
+		for i, idx := range candidates {
+			cumulative += probabilities[idx]
+			if cumulative >= c.TopP {
+				candidates = candidates[:i+1]
+				break
+			}
+		}
+	}
+
+	total := float32(0.0)
+	for _, idx := range candidates {
+		total += probabilities[idx]
+	}
+
+	r := c.float32() * total
+	for _, idx := range candidates {
+		r -= probabilities[idx]
+		if r <= 0 {
+			return idx
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// applyPenalties lowers the scores of tokens found in the history.
+func (c *SamplingConfig) applyPenalties(scores []float32, history []int) {
+	if len(history) == 0 {
+		return
+	}
+
+	counts := make(map[int]int)
+	for _, idx := range history {
+		if idx >= 0 && idx < len(scores) {
+			counts[idx]++
+		}
+	}
+
+	for idx, count := range counts {
+		if c.RepetitionPenalty > 0 && c.RepetitionPenalty != 1 {
+			if scores[idx] > 0 {
+				scores[idx] /= c.RepetitionPenalty
+			} else {
+				scores[idx] *= c.RepetitionPenalty
+			}
+		}
+		scores[idx] -= c.PresencePenalty
+		scores[idx] -= c.FrequencyPenalty * float32(count)
+	}
+
+	if c.NoRepeatNGramSize > 0 {
+		banned := bannedNGramTokens(history, c.NoRepeatNGramSize)
+		// Never ban every candidate, otherwise there is nothing left to pick.
+		if len(banned) < len(scores) {
+			for idx := range banned {
+				if idx >= 0 && idx < len(scores) {
+					scores[idx] = float32(math.Inf(-1))
+				}
+			}
+		}
+	}
+}
+
+// bannedNGramTokens returns the tokens that would complete an n-gram
+// already present in the history.
+func bannedNGramTokens(history []int, n int) map[int]bool {
+	banned := make(map[int]bool)
+	if len(history) < n-1 {
+		return banned
+	}
+
+	prefix := history[len(history)-(n-1):]
+	for i := 0; i+n-1 < len(history); i++ {
+		match := true
+		for j := 0; j < n-1; j++ {
+			if history[i+j] != prefix[j] {
+				match = false
+				break
+			}
+		}
+		if match {
+			banned[history[i+n-1]] = true
+		}
+	}
+	return banned
+}
+
+// withCurrent returns generatedTokens with currentTokenIndex appended when the
+// caller has not already done so.
+func withCurrent(currentTokenIndex int, generatedTokens []int) []int {
+	if len(generatedTokens) > 0 && generatedTokens[len(generatedTokens)-1] == currentTokenIndex {
+		return generatedTokens
+	}
+	h := make([]int, 0, len(generatedTokens)+1)
+	h = append(h, generatedTokens...)
+	return append(h, currentTokenIndex)
+}
+
+func (c *SamplingConfig) float32() float32 {
+	if c.Rand != nil {
+		return c.Rand.Float32()
+	}
+	return rand.Float32()
+}
+
+// intn returns a random index below n from c.Rand, or from the global
+// math/rand source when c or c.Rand is nil.
+func (c *SamplingConfig) intn(n int) int {
+	if c != nil && c.Rand != nil {
+		return c.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// argmax returns the index of the largest value, ignoring NaN.
+func argmax(input []float32) int {
+	best := 0
+	maxVal := float32(math.Inf(-1))
+	for i, v := range input {
+		if v > maxVal {
+			maxVal = v
+			best = i
+		}
+	}
+	return best
+}
@@ -0,0 +1,71 @@
+package core
+
+import "testing"
+
+func TestGreedySampling(t *testing.T) {
+	scores := []float32{0.1, 2.0, -1.0, 1.5}
+	if got := GreedySampling().Sample(scores, nil); got != 1 {
+		t.Errorf("greedy picked %d, want 1", got)
+	}
+
+	var nilConfig *SamplingConfig
+	if got := nilConfig.Sample([]float32{0.1, 2.0, -1.0, 1.5}, nil); got != 1 {
+		t.Errorf("nil config picked %d, want 1", got)
+	}
+}
+
+func TestTopKSampling(t *testing.T) {
+	config := NewSamplingConfig(1.0, 2, 0, 42)
+	for i := 0; i < 200; i++ {
+		got := config.Sample([]float32{0.1, 2.0, -1.0, 1.5}, nil)
+		if got != 1 && got != 3 {
+			t.Fatalf("top-k 2 sampled %d, want 1 or 3", got)
+		}
+	}
+}
+
+func TestSamplingIsSeedable(t *testing.T) {
+	a := NewSamplingConfig(1.0, 0, 0.9, 7)
+	b := NewSamplingConfig(1.0, 0, 0.9, 7)
+	for i := 0; i < 50; i++ {
+		x := a.Sample([]float32{0.5, 0.4, 0.3, 0.2, 0.1}, nil)
+		y := b.Sample([]float32{0.5, 0.4, 0.3, 0.2, 0.1}, nil)
+		if x != y {
+			t.Fatalf("step %d: same seed gave %d and %d", i, x, y)
+		}
+	}
+}
+
+func TestOutOfBoundsPredictIsSeedable(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("오늘 날씨가 정말 좋다 그리고 내일도 좋다")
+	a, b := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1), NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1)
+	a.Sampling = NewSamplingConfig(1.0, 0, 0, 7)
+	b.Sampling = NewSamplingConfig(1.0, 0, 0, 7)
+	for i := 0; i < 20; i++ {
+		if x, y := a.Predict(-1, nil), b.Predict(-1, nil); x != y {
+			t.Fatalf("step %d: same seed gave %d and %d", i, x, y)
+		}
+	}
+}
+
+func TestNoRepeatNGram(t *testing.T) {
+	config := GreedySampling()
+	config.NoRepeatNGramSize = 2
+
+	// History "0 1 0": the bigram (0, 1) was already used, so 1 is banned.
+	got := config.Sample([]float32{0.1, 2.0, -1.0, 1.5}, []int{0, 1, 0})
+	if got != 3 {
+		t.Errorf("picked %d, want 3", got)
+	}
+}
+
+func TestRepetitionPenalty(t *testing.T) {
+	config := GreedySampling()
+	config.RepetitionPenalty = 2.0
+
+	got := config.Sample([]float32{0.1, 2.0, -1.0, 1.5}, []int{1})
+	if got != 3 {
+		t.Errorf("picked %d, want 3", got)
+	}
+}
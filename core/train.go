@@ -0,0 +1,363 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"runtime"
+	"time"
+)
+
+// TrainConfig controls how a model is trained from a corpus.
+type TrainConfig struct {
+	LearningRate float32 // Base learning rate, see Schedule
+	Epochs       int
+	BatchSize    int
+	Objective    TrainObjective
+
+	// SparseWeights stores only the observed successors of each token, so
+	// memory grows with the number of transitions instead of the vocabulary
+	// squared. The successors a token was never seen with then share one
+	// score, see SparseWeights.
+	SparseWeights bool
+
+	// Optimizer updates the weights, SGD when nil. Schedule sets the
+	// learning rate of each epoch from LearningRate, constant when nil.
+	Optimizer Optimizer
+	Schedule  Schedule
+
+	// Workers is the number of goroutines training rows in parallel,
+	// runtime.NumCPU() when 0. The result does not depend on it.
+	Workers int
+
+	// Normalizer cleans the corpus, and later any text given to the
+	// tokenizer, before it is split into tokens.
+	Normalizer Normalizer
+
+	// PreTokenizer names the registered PreTokenizer splitting the corpus
+	// into tokens, whitespace when empty. Set it to KoreanPreTokenizer to
+	// split particles and endings from Korean words.
+	PreTokenizer string
+
+	// NGramOrder, if above 2, makes the tokenizer also count contexts of up
+	// to NGramOrder-1 tokens, so an NGramModel of that order can share it.
+	NGramOrder int
+
+	// BPEMerges, if positive, trains a BPE subword vocabulary of that many
+	// merges on the corpus. BPE splits words on whitespace, so PreTokenizer
+	// must then be empty or whitespace. The vocabulary is bounded by the
+	// merges and is not pruned.
+	BPEMerges int
+
+	// Vocabulary pruning before the model is created: tokens seen fewer than
+	// MinCount times are replaced by UNKTOKEN, and at most MaxVocab tokens
+	// are kept (no limit when 0). See Tokenizer.Prune.
+	MinCount int
+	MaxVocab int
+
+	// Fractions of the corpus used for training, per-epoch validation and
+	// the final test. They must not add up to more than 1.
+	TrainRatio      float64
+	ValidationRatio float64
+	TestRatio       float64
+
+	// Seed shuffles the corpus before it is split and the rows of every
+	// epoch. 0 uses the current time.
+	Seed int64
+
+	// CheckpointPath, if set, receives a checkpoint every CheckpointEvery
+	// epochs (every epoch when 0). ResumeTraining continues from it.
+	CheckpointPath  string
+	CheckpointEvery int
+
+	// Early stopping on the validation loss. Training stops once the loss has
+	// not improved by more than MinDelta for Patience epochs; 0 disables it.
+	// RestoreBest puts back the weights of the epoch with the lowest loss.
+	// Both need validation data.
+	Patience    int
+	MinDelta    float32
+	RestoreBest bool
+
+	// OnEpoch, if set, is called with the statistics of every finished epoch.
+	OnEpoch func(EpochStats)
+}
+
+// DefaultTrainConfig returns the recommended settings for
+// CreateAndTrainModelWithConfig. CreateAndTrainModel does not use them, so
+// existing callers keep training the way they always have.
+func DefaultTrainConfig() TrainConfig {
+	return TrainConfig{
+		LearningRate:    0.1,
+		Epochs:          5,
+		BatchSize:       2048,
+		Objective:       ObjectiveDistribution,
+		SparseWeights:   true,
+		Normalizer:      DefaultNormalizer(),
+		MinCount:        2,
+		TrainRatio:      0.8,
+		ValidationRatio: 0.1,
+		TestRatio:       0.1,
+		Patience:        2,
+		MinDelta:        1e-3,
+		RestoreBest:     true,
+	}
+}
+
+// legacyTrainConfig returns the settings CreateAndTrainModel has always
+// used: a random third of the texts for training, split on whitespace,
+// dense weights and the argmax objective. The other two thirds, which it
+// used to leave out, are the validation and test sets; without Patience
+// or RestoreBest they only report losses and do not change the model.
+func legacyTrainConfig(learningRate float32, epochs int) TrainConfig {
+	return TrainConfig{
+		LearningRate:    learningRate,
+		Epochs:          epochs,
+		BatchSize:       2048,
+		Objective:       ObjectiveArgmax,
+		TrainRatio:      1.0 / 3,
+		ValidationRatio: 1.0 / 3,
+		TestRatio:       1.0 / 3,
+	}
+}
+
+func (c TrainConfig) schedule() Schedule {
+	if c.Schedule == nil {
+		return ConstantSchedule{}
+	}
+	return c.Schedule
+}
+
+func (c TrainConfig) workers() int {
+	if c.Workers <= 0 {
+		return runtime.NumCPU()
+	}
+	return c.Workers
+}
+
+func (c TrainConfig) validate() error {
+	if c.TrainRatio <= 0 || c.ValidationRatio < 0 || c.TestRatio < 0 {
+		return errors.New("train config: ratios must be positive")
+	}
+	if c.TrainRatio+c.ValidationRatio+c.TestRatio > 1+1e-9 {
+		return errors.New("train config: ratios add up to more than 1")
+	}
+	if _, ok := LookupPreTokenizer(c.PreTokenizer); !ok {
+		return fmt.Errorf("train config: unknown pre-tokenizer %q", c.PreTokenizer)
+	}
+	if c.BPEMerges > 0 && c.PreTokenizer != "" && c.PreTokenizer != WhitespacePreTokenizer {
+		return fmt.Errorf("train config: BPE splits words itself and cannot use pre-tokenizer %q", c.PreTokenizer)
+	}
+	if c.MinCount < 0 || c.MaxVocab < 0 || c.BPEMerges < 0 || c.NGramOrder < 0 {
+		return errors.New("train config: min count, max vocab, n-gram order and BPE merges must be positive")
+	}
+	return c.validateTraining()
+}
+
+// validateTraining checks only the settings used once the corpus is split
+// and the tokenizer built, for training that continues an existing model.
+func (c TrainConfig) validateTraining() error {
+	if c.Epochs < 0 || c.BatchSize <= 0 || c.Patience < 0 || c.CheckpointEvery < 0 || c.Workers < 0 {
+		return errors.New("train config: epochs, batch size, patience, checkpoint interval and workers must be positive")
+	}
+	return nil
+}
+
+// SplitCorpus shuffles a copy of texts with cfg.Seed and splits it into
+// training, validation and test sets according to the ratios in cfg.
+func SplitCorpus(texts []string, cfg TrainConfig) (train, validation, test []string) {
+	shuffled := make([]string, len(texts))
+	copy(shuffled, texts)
+
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	rng := rand.New(rand.NewSource(seed))
+	rng.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+
+	trainEnd := int(float64(len(shuffled)) * cfg.TrainRatio)
+	validationEnd := trainEnd + int(float64(len(shuffled))*cfg.ValidationRatio)
+	testEnd := validationEnd + int(float64(len(shuffled))*cfg.TestRatio)
+	if testEnd > len(shuffled) {
+		testEnd = len(shuffled)
+	}
+	if validationEnd > testEnd {
+		validationEnd = testEnd
+	}
+
+	return shuffled[:trainEnd], shuffled[trainEnd:validationEnd], shuffled[validationEnd:testEnd]
+}
+
+// Transitions counts how often token i is followed by token j, in the same
+// layout as Tokenizer.UnigramFreq.
+type Transitions map[int]map[int]int
+
+func (t Transitions) Successors(idx int) map[int]int {
+	return t[idx]
+}
+
+// ContextSuccessors returns the successors of a one-token context; longer
+// contexts are not counted.
+func (t Transitions) ContextSuccessors(context []int) map[int]int {
+	if len(context) != 1 {
+		return nil
+	}
+	return t[context[0]]
+}
+
+// Evaluation summarizes how well a model predicts a set of transitions.
+type Evaluation struct {
+	Loss       float32 // Mean cross-entropy per transition
+	Perplexity float32 // exp(Loss)
+	Top1       float32 // Fraction of transitions whose successor scores highest, ties counting as misses
+	Top5       float32 // Fraction of transitions whose successor is among the 5 best, likewise
+}
+
+// EpochStats are the statistics of one training epoch.
+type EpochStats struct {
+	Epoch        int
+	LearningRate float32    // Rate given by the schedule for this epoch
+	TrainLoss    float32    // Mean cross-entropy of the trained rows against their targets
+	Validation   Evaluation // Zero when no validation data was given
+}
+
+// TrainHistory holds the statistics of every epoch of a training run.
+type TrainHistory struct {
+	Epochs       []EpochStats
+	BestEpoch    int  // Epoch with the lowest validation loss, -1 without validation
+	StoppedEarly bool // Training ended before cfg.Epochs because of early stopping
+}
+
+// ErrDiverged is returned when an epoch ends with a NaN or infinite loss.
+var ErrDiverged = errors.New("training diverged")
+
+// checkDiverged returns ErrDiverged when a loss of stats is not finite.
+// A validation loss that is NaN is never better than the best so far, so
+// early stopping cannot be left to notice it.
+func checkDiverged(stats EpochStats, hasValidation bool) error {
+	if !isFinite(stats.TrainLoss) {
+		return fmt.Errorf("%w: train loss %v at epoch %d", ErrDiverged, stats.TrainLoss, stats.Epoch)
+	}
+	if hasValidation && !isFinite(stats.Validation.Loss) {
+		return fmt.Errorf("%w: validation loss %v at epoch %d", ErrDiverged, stats.Validation.Loss, stats.Epoch)
+	}
+	return nil
+}
+
+func isFinite(v float32) bool {
+	return !math.IsNaN(float64(v)) && !math.IsInf(float64(v), 0)
+}
+
+// earlyStopping tracks the best validation loss of a training run.
+// Its fields are exported so checkpoints can store it.
+type earlyStopping struct {
+	Patience  int
+	MinDelta  float32
+	BestLoss  float32
+	BestEpoch int
+	Wait      int
+}
+
+func newEarlyStopping(cfg TrainConfig) earlyStopping {
+	return earlyStopping{
+		Patience:  cfg.Patience,
+		MinDelta:  cfg.MinDelta,
+		BestLoss:  float32(math.Inf(1)),
+		BestEpoch: -1,
+	}
+}
+
+// observe records the validation loss of an epoch and reports whether it
+// is a new best.
+func (e *earlyStopping) observe(epoch int, loss float32) bool {
+	if loss < e.BestLoss-e.MinDelta || e.BestEpoch < 0 {
+		e.BestLoss = loss
+		e.BestEpoch = epoch
+		e.Wait = 0
+		return true
+	}
+	e.Wait++
+	return false
+}
+
+// stop reports whether patience has run out.
+func (e *earlyStopping) stop() bool {
+	return e.Patience > 0 && e.Wait >= e.Patience
+}
+
+// evaluate scores every transition in data with the rows produced by scores.
+// Rows of unknown tokens (index >= size) are skipped.
+func evaluate(scores func(int, []float32) []float32, size int, data Transitions) Evaluation {
+	var row []float32
+	loss := 0.0
+	count, top1, top5 := 0, 0, 0
+	for tokIdx, freqMap := range data {
+		if tokIdx < 0 || tokIdx >= size {
+			continue
+		}
+		row = scores(tokIdx, row)
+		probabilities := softmax(row)
+
+		for nextID, freq := range freqMap {
+			if nextID < 0 || nextID >= len(probabilities) {
+				continue
+			}
+			loss -= float64(freq) * float64(safeLog(probabilities[nextID]))
+			count += freq
+
+			rank := scoreRank(row, nextID, 5)
+			if rank < 1 {
+				top1 += freq
+			}
+			if rank < 5 {
+				top5 += freq
+			}
+		}
+	}
+
+	if count == 0 {
+		nan := float32(math.NaN())
+		return Evaluation{Loss: nan, Perplexity: nan, Top1: nan, Top5: nan}
+	}
+	meanLoss := loss / float64(count)
+	return Evaluation{
+		Loss:       float32(meanLoss),
+		Perplexity: float32(math.Exp(meanLoss)),
+		Top1:       float32(top1) / float32(count),
+		Top5:       float32(top5) / float32(count),
+	}
+}
+
+// scoreRank returns the number of other tokens scoring at least as high as
+// token idx in row, counting up to limit. Ties count against idx, so the
+// columns a SparseWeights row shares one score for do not all rank first.
+func scoreRank(row []float32, idx, limit int) int {
+	rank := 0
+	for j, score := range row {
+		if j != idx && score >= row[idx] {
+			rank++
+			if rank >= limit {
+				break
+			}
+		}
+	}
+	return rank
+}
+
+// printEpochStats reports the end of an epoch on stdout.
+func printEpochStats(stats EpochStats, hasValidation bool) {
+	fmt.Printf("Done. train loss %.4f", stats.TrainLoss)
+	if hasValidation {
+		v := stats.Validation
+		fmt.Printf(", validation loss %.4f, perplexity %.2f, top-1 %.3f, top-5 %.3f", v.Loss, v.Perplexity, v.Top1, v.Top5)
+	}
+	fmt.Println()
+}
+
+// printEvaluation reports an evaluation of the named data set on stdout.
+func printEvaluation(name string, e Evaluation) {
+	fmt.Printf("%s loss %.4f, perplexity %.2f, top-1 %.3f, top-5 %.3f\n", name, e.Loss, e.Perplexity, e.Top1, e.Top5)
+}
@@ -0,0 +1,352 @@
+package core
+
+import (
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+func TestSplitCorpus(t *testing.T) {
+	texts := make([]string, 100)
+	for i := range texts {
+		texts[i] = string(rune('가' + i))
+	}
+
+	cfg := DefaultTrainConfig()
+	cfg.Seed = 1
+	train, validation, test := SplitCorpus(texts, cfg)
+	if len(train) != 80 || len(validation) != 10 || len(test) != 10 {
+		t.Errorf("split %d/%d/%d, want 80/10/10", len(train), len(validation), len(test))
+	}
+
+	seen := make(map[string]bool)
+	for _, part := range [][]string{train, validation, test} {
+		for _, text := range part {
+			if seen[text] {
+				t.Fatalf("%q appears in more than one split", text)
+			}
+			seen[text] = true
+		}
+	}
+
+	again, _, _ := SplitCorpus(texts, cfg)
+	for i := range train {
+		if train[i] != again[i] {
+			t.Fatal("same seed produced a different split")
+		}
+	}
+}
+
+func TestTrainConfigValidate(t *testing.T) {
+	cfg := DefaultTrainConfig()
+	cfg.TrainRatio = 0.9
+	if err := cfg.validate(); err == nil {
+		t.Error("ratios adding up to 1.1 were accepted")
+	}
+
+	cfg = DefaultTrainConfig()
+	cfg.BPEMerges = 10
+	cfg.PreTokenizer = KoreanPreTokenizer
+	if err := cfg.validate(); err == nil {
+		t.Error("BPE with the Korean pre-tokenizer was accepted")
+	}
+}
+
+func TestCreateAndTrainModelKeepsLegacySettings(t *testing.T) {
+	model, err := LoadModel(writeTestModel(t), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := model.Weights.(DenseWeights); !ok {
+		t.Errorf("weights are %T, want DenseWeights", model.Weights)
+	}
+	if model.Objective != ObjectiveArgmax {
+		t.Errorf("objective %v, want ObjectiveArgmax", model.Objective)
+	}
+	vocabulary := model.Lexicon.(*Vocabulary)
+	_, pruned := vocabulary.GetTokenIndex(UNKTOKEN)
+	if vocabulary.PreTokenizer != "" || vocabulary.Normalizer != (Normalizer{}) || pruned {
+		t.Errorf("tokenizer was not built from plain whitespace-separated words")
+	}
+
+	// A third is trained on as before; the rest is held out, not dropped.
+	texts := make([]string, 30)
+	for i := range texts {
+		texts[i] = formatTestTexts[i%len(formatTestTexts)]
+	}
+	train, validation, test := SplitCorpus(texts, legacyTrainConfig(0.5, 2))
+	if len(train) != 10 || len(validation) != 10 || len(test) != 10 {
+		t.Errorf("split %d/%d/%d, want 10/10/10", len(train), len(validation), len(test))
+	}
+}
+
+func TestEvaluateCountsTiesAsMisses(t *testing.T) {
+	// Like a SparseWeights row: one trained column, the rest share a score.
+	scores := func(i int, dst []float32) []float32 {
+		dst = resize(dst, 100)
+		for j := range dst {
+			dst[j] = 0
+		}
+		dst[1] = 5
+		return dst
+	}
+	eval := evaluate(scores, 100, Transitions{0: {1: 1, 50: 1}})
+	if eval.Top1 != 0.5 || eval.Top5 != 0.5 {
+		t.Errorf("top-1 %f, top-5 %f; want 0.5 for both, the tied successor missing", eval.Top1, eval.Top5)
+	}
+}
+
+func TestTrainHistory(t *testing.T) {
+	tokenizer := NewTokenizer()
+	tokenizer.AddtoModel("오늘 날씨가 정말 좋다")
+	tokenizer.AddtoModel("오늘 날씨가 정말 나쁘다")
+	tokenizer.BuildUnigramMap()
+	validation := CountTransitions(tokenizer, []string{"오늘 날씨가 정말 좋다"})
+
+	model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+	cfg := DefaultTrainConfig()
+	cfg.LearningRate = 1.0
+	cfg.Epochs = 30
+	cfg.Patience = 0
+
+	calls := 0
+	cfg.OnEpoch = func(EpochStats) { calls++ }
+	history, err := model.TrainWithConfig(cfg, validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(history.Epochs) != 30 || calls != 30 {
+		t.Fatalf("got %d epochs and %d callbacks, want 30", len(history.Epochs), calls)
+	}
+	first, last := history.Epochs[0], history.Epochs[29]
+	if last.TrainLoss >= first.TrainLoss {
+		t.Errorf("train loss did not decrease: %f -> %f", first.TrainLoss, last.TrainLoss)
+	}
+	if last.Validation.Top5 != 1 {
+		t.Errorf("top-5 accuracy %f, want 1", last.Validation.Top5)
+	}
+	if last.Validation.Perplexity >= first.Validation.Perplexity {
+		t.Errorf("perplexity did not decrease: %f -> %f", first.Validation.Perplexity, last.Validation.Perplexity)
+	}
+}
+
+func TestEarlyStoppingRestoresBest(t *testing.T) {
+	tokenizer := NewTokenizer()
+	for i := 0; i < 3; i++ {
+		tokenizer.AddtoModel("오늘 날씨가 정말 좋다")
+	}
+	tokenizer.AddtoModel("오늘 날씨가 정말 나쁘다")
+	tokenizer.BuildUnigramMap()
+	// The argmax objective drives P(나쁘다|정말) toward 0, so validation on it gets worse.
+	validation := CountTransitions(tokenizer, []string{"정말 나쁘다"})
+
+	model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 1.0)
+	cfg := DefaultTrainConfig()
+	cfg.LearningRate = 1.0
+	cfg.Epochs = 100
+	cfg.Objective = ObjectiveArgmax
+	cfg.Patience = 3
+	history, err := model.TrainWithConfig(cfg, validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !history.StoppedEarly {
+		t.Fatal("training did not stop early")
+	}
+	if len(history.Epochs) != history.BestEpoch+cfg.Patience+1 {
+		t.Errorf("ran %d epochs with best epoch %d and patience %d", len(history.Epochs), history.BestEpoch, cfg.Patience)
+	}
+
+	best := history.Epochs[history.BestEpoch].Validation.Loss
+	if got := model.Evaluate(validation).Loss; got-best > 1e-4 || best-got > 1e-4 {
+		t.Errorf("restored model has validation loss %f, best epoch had %f", got, best)
+	}
+}
+
+func TestDivergedTrainingFails(t *testing.T) {
+	tokenizer := NewTokenizer()
+	for _, text := range formatTestTexts {
+		tokenizer.AddtoModel(text)
+	}
+	validation := CountTransitions(tokenizer, formatTestTexts[:2])
+
+	model := NewLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1)
+	model.Weights = NewDenseWeights(tokenizer.Count, func() float32 { return float32(math.NaN()) })
+	cfg := DefaultTrainConfig()
+	cfg.Epochs = 5
+	history, err := model.TrainWithConfig(cfg, validation)
+	if !errors.Is(err, ErrDiverged) {
+		t.Fatalf("got %v, want ErrDiverged", err)
+	}
+	if len(history.Epochs) != 1 || history.StoppedEarly {
+		t.Errorf("ran %d epochs, stopped early %v; want 1 epoch and an error", len(history.Epochs), history.StoppedEarly)
+	}
+}
+
+func TestResumeTraining(t *testing.T) {
+	for name, newOptimizer := range map[string]func() Optimizer{
+		"sgd":  func() Optimizer { return &SGD{} },
+		"adam": func() Optimizer { return NewAdam() },
+	} {
+		t.Run(name, func(t *testing.T) { testResumeTraining(t, newOptimizer) })
+	}
+}
+
+func testResumeTraining(t *testing.T, newOptimizer func() Optimizer) {
+	newModel := func() (*LinearModel, Transitions) {
+		tokenizer := NewTokenizer()
+		for _, text := range formatTestTexts {
+			tokenizer.AddtoModel(text)
+		}
+		tokenizer.BuildUnigramMap()
+		model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.5)
+		return model, CountTransitions(tokenizer, formatTestTexts[:2])
+	}
+
+	cfg := DefaultTrainConfig()
+	cfg.Seed = 7
+	cfg.Epochs = 6
+	cfg.BatchSize = 2
+	cfg.Patience = 0
+	cfg.Schedule = StepDecay{Every: 2, Gamma: 0.5}
+
+	// An uninterrupted run.
+	full, validation := newModel()
+	want := full.Weights.Clone()
+	cfg.Optimizer = newOptimizer()
+	fullHistory, err := full.TrainWithConfig(cfg, validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same run interrupted after 3 epochs and resumed from its checkpoint.
+	interrupted, _ := newModel()
+	interrupted.Weights = want
+	partial := cfg
+	partial.Epochs = 3
+	partial.Optimizer = newOptimizer()
+	partial.CheckpointPath = filepath.Join(t.TempDir(), "checkpoint.bin")
+	if _, err := interrupted.TrainWithConfig(partial, validation); err != nil {
+		t.Fatal(err)
+	}
+	partial.Epochs = cfg.Epochs
+	resumed, history, err := ResumeTraining(partial.CheckpointPath, partial, validation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bad := partial
+	bad.BatchSize = 0
+	if _, _, err := ResumeTraining(partial.CheckpointPath, bad, validation); err == nil {
+		t.Error("resuming with a batch size of 0 was accepted")
+	}
+	// Resuming neither splits a corpus nor builds a tokenizer, so the
+	// ratios and pre-tokenizer need not be set.
+	minimal := TrainConfig{Epochs: cfg.Epochs, BatchSize: cfg.BatchSize}
+	if _, _, err := ResumeTraining(partial.CheckpointPath, minimal, nil); err != nil {
+		t.Errorf("resuming with only epochs and batch size: %v", err)
+	}
+
+	if len(history.Epochs) != len(fullHistory.Epochs) {
+		t.Fatalf("resumed history has %d epochs, want %d", len(history.Epochs), len(fullHistory.Epochs))
+	}
+	for i := 0; i < full.Weights.Size(); i++ {
+		a, b := full.Weights.Scores(i, nil), resumed.Weights.Scores(i, nil)
+		for j := range a {
+			if a[j] != b[j] {
+				t.Fatalf("weight (%d, %d) = %f after resuming, %f uninterrupted", i, j, b[j], a[j])
+			}
+		}
+	}
+}
+
+func TestSchedules(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		epoch    int
+		want     float32
+	}{
+		{"constant", ConstantSchedule{}, 7, 0.1},
+		{"step decay", StepDecay{Every: 2, Gamma: 0.5}, 5, 0.025},
+		{"cosine start", CosineSchedule{}, 0, 0.1},
+		{"cosine end", CosineSchedule{MinRate: 0.01}, 9, 0.01},
+		{"warmup", Warmup{Epochs: 4}, 1, 0.04},
+		{"after warmup", Warmup{Epochs: 4, Then: StepDecay{Every: 1, Gamma: 0.5}}, 5, 0.05},
+	}
+	for _, tt := range tests {
+		got := tt.schedule.Rate(0.1, tt.epoch, 10)
+		if diff := got - tt.want; diff > 1e-6 || diff < -1e-6 {
+			t.Errorf("%s: rate at epoch %d = %f, want %f", tt.name, tt.epoch, got, tt.want)
+		}
+	}
+}
+
+func TestAdamConvergesFasterThanSGD(t *testing.T) {
+	finalLoss := func(optimizer Optimizer) float32 {
+		tokenizer := NewTokenizer()
+		for _, text := range formatTestTexts {
+			tokenizer.AddtoModel(text)
+		}
+		tokenizer.BuildUnigramMap()
+
+		model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.05)
+		cfg := DefaultTrainConfig()
+		cfg.LearningRate = 0.05
+		cfg.Epochs = 20
+		cfg.Optimizer = optimizer
+		history, err := model.TrainWithConfig(cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return history.Epochs[len(history.Epochs)-1].TrainLoss
+	}
+
+	sgd, adam := finalLoss(&SGD{}), finalLoss(NewAdam())
+	if adam >= sgd {
+		t.Errorf("after 20 epochs Adam loss %f is not below SGD loss %f", adam, sgd)
+	}
+}
+
+func TestParallelTrainingIsDeterministic(t *testing.T) {
+	train := func(workers int) (*LinearModel, TrainHistory) {
+		tokenizer := NewTokenizer()
+		for _, text := range formatTestTexts {
+			tokenizer.AddtoModel(text)
+		}
+		tokenizer.BuildUnigramMap()
+
+		model := NewSparseLinearModel(tokenizer.Vocabulary, tokenizer.TransitionCounts, 0.1)
+		model.Weights = NewSparseWeights(tokenizer.Count, tokenizer.UnigramFreq, func() float32 { return 0 })
+		cfg := DefaultTrainConfig()
+		cfg.Seed = 3
+		cfg.Epochs = 4
+		cfg.BatchSize = 3
+		cfg.Optimizer = NewAdam()
+		cfg.Workers = workers
+		history, err := model.TrainWithConfig(cfg, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return model, history
+	}
+
+	serial, serialHistory := train(1)
+	parallel, parallelHistory := train(4)
+	for e := range serialHistory.Epochs {
+		if a, b := serialHistory.Epochs[e].TrainLoss, parallelHistory.Epochs[e].TrainLoss; a != b {
+			t.Errorf("epoch %d: train loss %f with 4 workers, %f with 1", e, b, a)
+		}
+	}
+	for i := 0; i < serial.Weights.Size(); i++ {
+		a, b := serial.Weights.Scores(i, nil), parallel.Weights.Scores(i, nil)
+		for j := range a {
+			if a[j] != b[j] {
+				t.Fatalf("weight (%d, %d) = %f with 4 workers, %f with 1", i, j, b[j], a[j])
+			}
+		}
+	}
+}
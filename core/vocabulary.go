@@ -0,0 +1,97 @@
+package core
+
+// Lexicon maps text to token indices and back. *Vocabulary implements it.
+type Lexicon interface {
+	GetTokenIndex(token string) (int, bool)
+	GetToken(idx int) string
+	Tokenize(text string) []string
+	Detokenize(tokens []string) string
+	// Size returns the number of tokens; indices run from 0 to Size()-1.
+	Size() int
+}
+
+// Vocabulary assigns an index to every token and splits text into tokens.
+type Vocabulary struct {
+	Tokens       map[string]int
+	Count        int
+	TokenList    []string   // Index to token, the reverse of Tokens
+	PreTokenizer string     // Name of the registered PreTokenizer, whitespace when empty
+	BPE          *BPE       // Subword merges, used instead of PreTokenizer when set
+	Normalizer   Normalizer // Applied to text before it is split
+}
+
+// NewVocabulary creates an empty Vocabulary splitting on whitespace.
+func NewVocabulary() *Vocabulary {
+	return &Vocabulary{Tokens: make(map[string]int)}
+}
+
+// addWord returns the index of token, registering it if it is new.
+func (v *Vocabulary) addWord(token string) int {
+	if idx, exists := v.Tokens[token]; exists {
+		return idx
+	}
+	idx := v.Count
+	v.Tokens[token] = idx
+	v.TokenList = append(v.TokenList, token)
+	v.Count++
+	return idx
+}
+
+// rebuildTokenList restores the reverse index for tokenizers saved
+// before TokenList was persisted.
+func (v *Vocabulary) rebuildTokenList() {
+	v.TokenList = make([]string, v.Count)
+	for k, idx := range v.Tokens {
+		if idx >= 0 && idx < v.Count {
+			v.TokenList[idx] = k
+		}
+	}
+}
+
+func (v *Vocabulary) GetTokenIndex(token string) (int, bool) {
+	idx, exists := v.Tokens[token]
+	return idx, exists
+}
+
+func (v *Vocabulary) Size() int { return v.Count }
+
+func (v *Vocabulary) GetToken(idx int) string {
+	if idx < 0 || idx >= len(v.TokenList) {
+		return ""
+	}
+	return v.TokenList[idx]
+}
+
+// Tokenize normalizes text with the vocabulary's Normalizer and splits it
+// into tokens with its PreTokenizer.
+func (v *Vocabulary) Tokenize(text string) []string {
+	return v.preTokenizer().Split(v.Normalizer.Normalize(text))
+}
+
+// Detokenize joins generated tokens back into text with the vocabulary's
+// PreTokenizer.
+func (v *Vocabulary) Detokenize(tokens []string) string {
+	return v.preTokenizer().Join(tokens)
+}
+
+// UseBPE makes the vocabulary split words into the subwords of b and adds
+// every subword b can produce, so any text can be tokenized without
+// unknown tokens.
+func (v *Vocabulary) UseBPE(b *BPE) {
+	v.BPE = b
+	for _, symbol := range b.Symbols() {
+		v.addWord(symbol)
+	}
+}
+
+// preTokenizer returns v.BPE when set, otherwise the PreTokenizer named by
+// v.PreTokenizer, falling back to whitespace when it is not registered.
+func (v *Vocabulary) preTokenizer() PreTokenizer {
+	if v.BPE != nil {
+		return v.BPE
+	}
+	if p, ok := LookupPreTokenizer(v.PreTokenizer); ok {
+		return p
+	}
+	return whitespaceSplitter{}
+}
@@ -0,0 +1,230 @@
+package core
+
+import (
+	"math"
+	"sort"
+)
+
+// WeightMatrix is the vocab x vocab transition matrix of a LinearModel.
+// Row i holds the scores of every possible successor of token i.
+type WeightMatrix interface {
+	// Size returns the vocabulary size (the matrix is square).
+	Size() int
+	// Scores writes the dense scores of row i into dst, growing it if needed.
+	Scores(i int, dst []float32) []float32
+	// Params returns the trainable parameters of row i. The slice aliases
+	// the matrix, so updating it updates the weights.
+	Params(i int) []float32
+	// Backward computes the softmax cross-entropy of row i against the
+	// target distribution. It writes the gradient with respect to Params(i)
+	// into grad, growing it if needed, and returns it with the loss.
+	Backward(i int, target map[int]float32, grad []float32) ([]float32, float32)
+	// Clone returns a deep copy of the matrix.
+	Clone() WeightMatrix
+}
+
+// DenseWeights stores every entry of the matrix.
+type DenseWeights [][]float32
+
+// NewDenseWeights creates a vocabSize x vocabSize matrix filled by init.
+func NewDenseWeights(vocabSize int, init func() float32) DenseWeights {
+	weights := make(DenseWeights, vocabSize)
+	for i := range weights {
+		weights[i] = make([]float32, vocabSize)
+		for j := range weights[i] {
+			weights[i][j] = init()
+		}
+	}
+	return weights
+}
+
+func (w DenseWeights) Size() int { return len(w) }
+
+func (w DenseWeights) Scores(i int, dst []float32) []float32 {
+	dst = resize(dst, len(w[i]))
+	copy(dst, w[i])
+	return dst
+}
+
+func (w DenseWeights) Params(i int) []float32 { return w[i] }
+
+func (w DenseWeights) Backward(i int, target map[int]float32, grad []float32) ([]float32, float32) {
+	probabilities := softmax(w[i])
+	grad = resize(grad, len(probabilities))
+
+	// Calculate gradient for the scores (y_pred - y_true)
+	copy(grad, probabilities)
+
+	// Sum in column order so the loss does not depend on map order.
+	cols := make([]int, 0, len(target))
+	for j := range target {
+		cols = append(cols, j)
+	}
+	sort.Ints(cols)
+	loss := float32(0.0)
+	for _, j := range cols {
+		t := target[j]
+		grad[j] -= t
+		loss -= t * safeLog(probabilities[j])
+	}
+	return grad, loss
+}
+
+func (w DenseWeights) Clone() WeightMatrix {
+	clone := make(DenseWeights, len(w))
+	for i, row := range w {
+		clone[i] = append([]float32(nil), row...)
+	}
+	return clone
+}
+
+// SparseRow stores the explicit entries of one row of a SparseWeights.
+// Vals has one more element than Cols: the last value is shared by every
+// column that is not listed in Cols.
+type SparseRow struct {
+	Cols []int32
+	Vals []float32
+}
+
+// Default returns the score shared by every column not in Cols.
+func (r *SparseRow) Default() float32 {
+	return r.Vals[len(r.Vals)-1]
+}
+
+// find returns the position of col in Cols, or -1.
+func (r *SparseRow) find(col int) int {
+	k := sort.Search(len(r.Cols), func(k int) bool { return int(r.Cols[k]) >= col })
+	if k < len(r.Cols) && int(r.Cols[k]) == col {
+		return k
+	}
+	return -1
+}
+
+// insert adds col as an explicit entry initialized to the default score.
+func (r *SparseRow) insert(col int) {
+	k := sort.Search(len(r.Cols), func(k int) bool { return int(r.Cols[k]) >= col })
+	if k < len(r.Cols) && int(r.Cols[k]) == col {
+		return
+	}
+	r.Cols = append(r.Cols, 0)
+	copy(r.Cols[k+1:], r.Cols[k:])
+	r.Cols[k] = int32(col)
+
+	r.Vals = append(r.Vals, 0)
+	copy(r.Vals[k+1:], r.Vals[k:])
+	r.Vals[k] = r.Vals[len(r.Vals)-1]
+}
+
+// SparseWeights stores only the observed successors of each token.
+// Columns that are never a target of a row keep identical scores under
+// softmax cross-entropy training, so sharing one value for them is exact.
+type SparseWeights struct {
+	Rows []SparseRow
+	N    int
+}
+
+// NewSparseWeights creates a matrix with an explicit entry for every observed
+// successor in freq. Entries are filled by init and the shared value starts at 0.
+func NewSparseWeights(vocabSize int, freq map[int]map[int]int, init func() float32) *SparseWeights {
+	w := &SparseWeights{Rows: make([]SparseRow, vocabSize), N: vocabSize}
+	for i := range w.Rows {
+		cols := make([]int32, 0, len(freq[i]))
+		for nextID := range freq[i] {
+			cols = append(cols, int32(nextID))
+		}
+		sort.Slice(cols, func(a, b int) bool { return cols[a] < cols[b] })
+
+		vals := make([]float32, len(cols)+1)
+		for k := range cols {
+			vals[k] = init()
+		}
+		w.Rows[i] = SparseRow{Cols: cols, Vals: vals}
+	}
+	return w
+}
+
+func (w *SparseWeights) Size() int { return w.N }
+
+func (w *SparseWeights) Scores(i int, dst []float32) []float32 {
+	dst = resize(dst, w.N)
+	row := &w.Rows[i]
+	def := row.Default()
+	for j := range dst {
+		dst[j] = def
+	}
+	for k, col := range row.Cols {
+		dst[col] = row.Vals[k]
+	}
+	return dst
+}
+
+func (w *SparseWeights) Params(i int) []float32 { return w.Rows[i].Vals }
+
+func (w *SparseWeights) Backward(i int, target map[int]float32, grad []float32) ([]float32, float32) {
+	row := &w.Rows[i]
+	for col := range target {
+		if row.find(col) < 0 {
+			row.insert(col)
+		}
+	}
+
+	// Log-sum-exp over the explicit entries plus the shared columns.
+	n := len(row.Cols)
+	shared := w.N - n
+	def := row.Default()
+	maxVal := def
+	for k := 0; k < n; k++ {
+		if row.Vals[k] > maxVal {
+			maxVal = row.Vals[k]
+		}
+	}
+	sum := float64(shared) * math.Exp(float64(def-maxVal))
+	for k := 0; k < n; k++ {
+		sum += math.Exp(float64(row.Vals[k] - maxVal))
+	}
+	logZ := float64(maxVal) + math.Log(sum)
+
+	grad = resize(grad, n+1)
+	for k := 0; k < n; k++ {
+		grad[k] = float32(math.Exp(float64(row.Vals[k]) - logZ))
+	}
+	grad[n] = float32(float64(shared) * math.Exp(float64(def)-logZ))
+
+	// Every target is an explicit entry now; walking Cols keeps the loss
+	// independent of map order.
+	loss := float32(0.0)
+	for k, col := range row.Cols {
+		if t, ok := target[int(col)]; ok {
+			loss -= t * float32(float64(row.Vals[k])-logZ)
+			grad[k] -= t
+		}
+	}
+	return grad, loss
+}
+
+func (w *SparseWeights) Clone() WeightMatrix {
+	clone := &SparseWeights{Rows: make([]SparseRow, len(w.Rows)), N: w.N}
+	for i, row := range w.Rows {
+		clone.Rows[i] = SparseRow{
+			Cols: append([]int32(nil), row.Cols...),
+			Vals: append([]float32(nil), row.Vals...),
+		}
+	}
+	return clone
+}
+
+// resize returns s with length n, reallocating only when needed.
+func resize(s []float32, n int) []float32 {
+	if cap(s) < n {
+		return make([]float32, n)
+	}
+	return s[:n]
+}
+
+// safeLog returns log(p), clamped to avoid -Inf.
+func safeLog(p float32) float32 {
+	if p < 1e-12 {
+		p = 1e-12
+	}
+	return float32(math.Log(float64(p)))
+}
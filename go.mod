@@ -5,4 +5,5 @@ go 1.24.0
 require (
 	github.com/x448/float16 v0.8.4
 	golang.org/x/net v0.44.0
+	golang.org/x/text v0.29.0
 )
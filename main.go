@@ -2,7 +2,9 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,15 +17,66 @@ import (
 	"time"
 )
 
+// Online learning settings: SGD steps per timeline read, and how many
+// reads happen between saves of the updated model. generateAttempts is how
+// often generation is tried when it gives no text.
+const (
+	learnSteps       = 3
+	saveEvery        = 6
+	generateAttempts = 3
+)
+
+type Account struct {
+	ID string `json:"id"`
+}
+
 type Status struct {
-	Content string `json:"content"`
+	ID      string  `json:"id"`
+	Content string  `json:"content"`
+	Account Account `json:"account"`
+	Reblog  *Status `json:"reblog"`
+}
+
+// verifyCredentials returns the account the key belongs to.
+func verifyCredentials(server, key string) (Account, error) {
+	apiURL := fmt.Sprintf("%s/api/v1/accounts/verify_credentials", server)
+	req, err := http.NewRequest("GET", apiURL, nil)
+	if err != nil {
+		return Account{}, fmt.Errorf("error creating request: %v", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Account{}, fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return Account{}, fmt.Errorf("failed to verify credentials: %s, body: %s", resp.Status, string(bodyBytes))
+	}
+
+	var account Account
+	if err := json.NewDecoder(resp.Body).Decode(&account); err != nil {
+		return Account{}, fmt.Errorf("error decoding account: %v", err)
+	}
+
+	return account, nil
 }
 
-func getTimeline(server, key string) (string, error) {
+// getTimeline returns the home timeline, newest first. When sinceID is set
+// only statuses newer than it are returned.
+func getTimeline(server, key, sinceID string) ([]Status, error) {
 	apiURL := fmt.Sprintf("%s/api/v1/timelines/home", server)
+	if sinceID != "" {
+		apiURL += "?since_id=" + url.QueryEscape(sinceID)
+	}
 	req, err := http.NewRequest("GET", apiURL, nil)
 	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
+		return nil, fmt.Errorf("error creating request: %v", err)
 	}
 
 	req.Header.Set("Authorization", "Bearer "+key)
@@ -31,27 +84,21 @@ func getTimeline(server, key string) (string, error) {
 	client := &http.Client{}
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("error sending request: %v", err)
+		return nil, fmt.Errorf("error sending request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to get timeline: %s, body: %s", resp.Status, string(bodyBytes))
+		return nil, fmt.Errorf("failed to get timeline: %s, body: %s", resp.Status, string(bodyBytes))
 	}
 
 	var statuses []Status
 	if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
-		return "", fmt.Errorf("error decoding timeline: %v", err)
+		return nil, fmt.Errorf("error decoding timeline: %v", err)
 	}
 
-	var timelineContent strings.Builder
-	for _, status := range statuses {
-		timelineContent.WriteString(status.Content)
-		timelineContent.WriteString(" ")
-	}
-
-	return timelineContent.String(), nil
+	return statuses, nil
 }
 
 func main() {
@@ -64,61 +111,88 @@ func main() {
 		log.Fatal("MSTDN_KEY and MSTDN_SERVER must be set")
 	}
 
+	self, err := verifyCredentials(server, key)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	model, err := core.LoadModel("model.bin", 0.01)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 
+	model.Sampling = core.NewSamplingConfig(0.8, 40, 0.9, time.Now().UnixNano())
+	model.Sampling.RepetitionPenalty = 1.3
+	model.Sampling.NoRepeatNGramSize = 2
+
 	extractor := core.NewExtractor(model)
 
-	for {
-		generatedIndices := []int{}
-		var content strings.Builder
+	var generator core.Generator = model
 
-		timelineText, err := getTimeline(server, key)
+	var lastID string
+	for round := 1; ; round++ {
+		statuses, err := getTimeline(server, key, lastID)
 		if err != nil {
 			log.Printf("Could not get timeline: %v", err)
 		}
 
+		var timelineContent strings.Builder
+		var posts []string
+		for _, status := range statuses {
+			timelineContent.WriteString(status.Content)
+			timelineContent.WriteString(" ")
+			// Never learn from our own posts, or the model would keep
+			// training on what it generated, nor from reblogs.
+			if status.Account.ID == self.ID || status.Reblog != nil {
+				continue
+			}
+			if post := core.CleanText(model.Lexicon, status.Content); post != "" {
+				posts = append(posts, post)
+			}
+		}
+		timelineText := timelineContent.String()
+		if len(statuses) > 0 {
+			lastID = statuses[0].ID
+		}
+
+		// Learn from the new posts and save the model now and then
+		if len(posts) > 0 {
+			if loss, err := model.Learn(posts, learnSteps); err != nil {
+				log.Printf("Could not learn from posts: %v", err)
+			} else {
+				fmt.Printf("Learned from %d posts, loss %.4f, vocabulary %d\n", len(posts), loss, model.Lexicon.Size())
+			}
+		}
+		if round%saveEvery == 0 {
+			if err := core.SaveModel(model, "model.bin"); err != nil {
+				log.Printf("Could not save model: %v", err)
+			}
+		}
+
 		keywords := extractor.Extract(timelineText, 1)
 
-		var initialToken string
+		var prompt string
 		if len(keywords) > 0 {
-			initialToken = keywords[0].Token
-			fmt.Printf("Starting with keyword: %s\n", initialToken)
+			prompt = keywords[0].Token
+			fmt.Printf("Starting with keyword: %s\n", prompt)
 		} else {
-			initialToken = pick(model.Tokenizer.Count, *model.Tokenizer)
-			fmt.Println("Could not extract keywords, starting with random token.")
+			fmt.Println("Could not extract keywords, starting a new sentence.")
 		}
 
-		initialIndex, ok := model.Tokenizer.Tokens[initialToken]
-		if !ok {
-			fmt.Println("Keyword not in tokenizer, picking random token.")
-			initialToken = pick(model.Tokenizer.Count, *model.Tokenizer)
-			initialIndex = model.Tokenizer.Tokens[initialToken]
+		var content strings.Builder
+		generated, err := generator.Generate(context.Background(), prompt, core.GenerateOptions{MaxTokens: 50})
+		// A sampled sentence can end right away; try again before giving up
+		for attempt := 1; errors.Is(err, core.ErrEmptyText) && attempt < generateAttempts; attempt++ {
+			generated, err = generator.Generate(context.Background(), prompt, core.GenerateOptions{MaxTokens: 50})
 		}
-
-		generatedIndices = append(generatedIndices, initialIndex)
-		content.WriteString(initialToken)
-		content.WriteString(" ")
-
-		// Continue generating the sentence from the initial token.
-		currentIndex := initialIndex
-		for i := 0; i < 50; i++ { // Generate up to 50 more tokens
-			predictedIndex := model.Predict(currentIndex, generatedIndices)
-			predictedToken := model.Tokenizer.GetToken(predictedIndex)
-
-			if predictedToken == core.ENDTOKEN {
-				break // Stop at end token
-			}
-
-			generatedIndices = append(generatedIndices, predictedIndex)
-			content.WriteString(predictedToken)
-			content.WriteString(" ")
-
-			currentIndex = predictedIndex
+		if err != nil {
+			// Never post an empty status
+			log.Printf("Could not generate content: %v", err)
+			time.Sleep(20 * time.Minute)
+			continue
 		}
+		content.WriteString(generated)
 
 		//content.WriteString("#GenereatedByBot")
 
@@ -156,14 +230,3 @@ func main() {
 		time.Sleep(20 * time.Minute)
 	}
 }
-
-func pick(length int, dict core.Tokenizer) string {
-	rndn := rand.Intn(length)
-	for key := range dict.Tokens {
-		if rndn == 0 {
-			return key
-		}
-		rndn--
-	}
-	panic("unreachable!")
-}